@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// spectralFrameSize is the number of samples of each frame that the spectral distance compares.
+const spectralFrameSize = 1024
+
+// channelDiff are the error metrics of one output channel of two renders.
+type channelDiff struct {
+	Channel     int     `json:"channel"`
+	MaxAbsDiff  float64 `json:"maxAbsDiff"`
+	NonFinite   int     `json:"nonFinite"`
+	WithinLimit bool    `json:"withinLimit"`
+
+	// SNR is the ratio in dB of the first render to the difference, or nil if they are identical.
+	SNR *float64 `json:"snr"`
+
+	// SpectralDistance is the RMS difference in dB of the magnitude spectra, averaged over frames.
+	SpectralDistance float64 `json:"spectralDistance"`
+}
+
+// compareRenders computes the error metrics of every channel of two renders with the same length.
+// NaN and infinite samples are counted and left out of the other metrics.
+func compareRenders(a, b [][]float32, tolerance float64) []channelDiff {
+	diffs := make([]channelDiff, len(a))
+	for ch := range a {
+		var (
+			d             = channelDiff{Channel: ch}
+			signal, noise float64
+			left, right   = a[ch], b[ch]
+		)
+		for i := range left {
+			x, y := float64(left[i]), float64(right[i])
+			if math.IsNaN(x) || math.IsInf(x, 0) || math.IsNaN(y) || math.IsInf(y, 0) {
+				d.NonFinite++
+				continue
+			}
+			d.MaxAbsDiff = math.Max(d.MaxAbsDiff, math.Abs(x-y))
+			signal += x * x
+			noise += (x - y) * (x - y)
+		}
+		if noise > 0 {
+			snr := 10 * math.Log10(math.Max(signal, 1e-30)/noise)
+			d.SNR = &snr
+		}
+		d.SpectralDistance = spectralDistance(left, right)
+		d.WithinLimit = d.NonFinite == 0 && d.MaxAbsDiff <= tolerance
+		diffs[ch] = d
+	}
+	return diffs
+}
+
+// spectralDistance returns the log spectral distance in dB of two signals,
+// averaged over Hann-windowed frames. Magnitudes are floored at -120 dB.
+func spectralDistance(a, b []float32) float64 {
+	var (
+		total  float64
+		frames int
+		window = make([]float64, spectralFrameSize)
+		fa     = make([]complex128, spectralFrameSize)
+		fb     = make([]complex128, spectralFrameSize)
+	)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/spectralFrameSize)
+	}
+	for pos := 0; pos < len(a); pos += spectralFrameSize {
+		for i := range window {
+			var x, y float64
+			if pos+i < len(a) {
+				x, y = finiteSample(a[pos+i]), finiteSample(b[pos+i])
+			}
+			fa[i], fb[i] = complex(x*window[i], 0), complex(y*window[i], 0)
+		}
+		fft(fa)
+		fft(fb)
+
+		var sum float64
+		for k := 0; k <= spectralFrameSize/2; k++ {
+			d := magnitudeDB(fa[k]) - magnitudeDB(fb[k])
+			sum += d * d
+		}
+		total += math.Sqrt(sum / (spectralFrameSize/2 + 1))
+		frames++
+	}
+	if frames == 0 {
+		return 0
+	}
+	return total / float64(frames)
+}
+
+// finiteSample returns a sample, or 0 if it is NaN or infinite.
+func finiteSample(v float32) float64 {
+	if x := float64(v); !math.IsNaN(x) && !math.IsInf(x, 0) {
+		return x
+	}
+	return 0
+}
+
+// magnitudeDB returns the magnitude of a frequency bin in dB, floored at -120 dB.
+func magnitudeDB(c complex128) float64 {
+	return 20 * math.Log10(math.Max(cmplx.Abs(c), 1e-6))
+}
+
+// fft computes the discrete Fourier transform in place.
+// The length of x must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
+
+// audioDiff runs the diff command with -audio.
+func (c *controller) audioDiff() error {
+	fset := c.flagSets["diff"]
+
+	opts := renderOptions{
+		SampleRate: *c.diffSampleRate,
+		BlockSize:  *c.diffBlockSize,
+		Duration:   *c.diffDuration,
+		Channels:   *c.diffChannels,
+		Params:     c.diffParams,
+		Release:    *c.diffRelease,
+		Seed:       *c.diffSeed,
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+	renders := make([][][]float32, 2)
+	for i, path := range fset.Args() {
+		def, err := readSynthdefFile(path)
+		if err != nil {
+			return err
+		}
+		if opts.Release >= 0 && !hasParam(def, gateParam) {
+			return errors.Errorf("-release needs a %s param, %s has none", gateParam, path)
+		}
+		r, err := newRenderer(def, opts)
+		if err != nil {
+			return err
+		}
+		renders[i] = r.render()
+	}
+	diffs := compareRenders(renders[0], renders[1], *c.diffTolerance)
+
+	var err error
+	switch *c.diffOutput {
+	case "json":
+		err = writeJSON(os.Stdout, diffs)
+	case "text":
+		err = writeChannelDiffs(os.Stdout, diffs)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.diffOutput)
+	}
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, d := range diffs {
+		if !d.WithinLimit {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%s and %s differ by more than %g on %d channel(s)", fset.Arg(0), fset.Arg(1), *c.diffTolerance, failed)
+	}
+	return nil
+}
+
+// writeChannelDiffs writes a table of the error metrics of every channel.
+func writeChannelDiffs(w io.Writer, diffs []channelDiff) error {
+	fmt.Fprintf(w, "%-8s %-12s %-12s %-18s %s\n", "channel", "max diff", "snr", "spectral distance", "nan/inf")
+	for _, d := range diffs {
+		snr := "inf"
+		if d.SNR != nil {
+			snr = fmt.Sprintf("%.2f dB", *d.SNR)
+		}
+		spectral := fmt.Sprintf("%.2f dB", d.SpectralDistance)
+		fmt.Fprintf(w, "%-8d %-12.4g %-12s %-18s %d\n", d.Channel, d.MaxAbsDiff, snr, spectral, d.NonFinite)
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// Defaults of audio test specs.
+const (
+	audioTestSampleRate   = 48000
+	audioTestBlockSize    = 64
+	audioTestChannels     = 2
+	audioTestDuration     = 1
+	audioTestSilenceBelow = -90
+	audioTestTolerance    = 1e-4
+)
+
+// audioTestSpec is a set of audio tests for a synthdef.
+type audioTestSpec struct {
+	// Synthdef is the synthdef file, relative to the spec file.
+	Synthdef   string      `json:"synthdef"`
+	SampleRate float64     `json:"sampleRate"`
+	BlockSize  int         `json:"blockSize"`
+	Channels   int         `json:"channels"`
+	Seed       int64       `json:"seed"`
+	Tests      []audioTest `json:"tests"`
+}
+
+// audioTest renders a synthdef with a set of params and checks the result.
+type audioTest struct {
+	Name     string             `json:"name"`
+	Params   map[string]float32 `json:"params"`
+	Duration float64            `json:"duration"`
+
+	// Release is the time in seconds at which the gate param is set to 0.
+	Release *float64    `json:"release"`
+	Expect  audioExpect `json:"expect"`
+}
+
+// audioExpect are the expectations of an audio test. Levels are in dBFS.
+type audioExpect struct {
+	PeakBelow *float64 `json:"peakBelow"`
+	RMSAbove  *float64 `json:"rmsAbove"`
+	RMSBelow  *float64 `json:"rmsBelow"`
+
+	// Finite expects no NaN or infinite samples.
+	Finite bool `json:"finite"`
+
+	// SilentAfter is the time in seconds after which every sample is below SilenceBelow.
+	SilentAfter  *float64 `json:"silentAfter"`
+	SilenceBelow *float64 `json:"silenceBelow"`
+
+	// Golden is a WAV file, relative to the spec file, that the render must match
+	// to within Tolerance for every sample.
+	Golden    string  `json:"golden"`
+	Tolerance float64 `json:"tolerance"`
+}
+
+// readAudioTestSpec reads an audio test spec from a JSON file and fills in the defaults.
+func readAudioTestSpec(path string) (*audioTestSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	spec := &audioTestSpec{}
+	if err := json.NewDecoder(f).Decode(spec); err != nil {
+		return nil, errors.Wrap(err, "decoding "+path)
+	}
+	if spec.Synthdef == "" {
+		return nil, errors.Errorf("%s has no synthdef", path)
+	}
+	if spec.SampleRate == 0 {
+		spec.SampleRate = audioTestSampleRate
+	}
+	if spec.BlockSize == 0 {
+		spec.BlockSize = audioTestBlockSize
+	}
+	if spec.Channels == 0 {
+		spec.Channels = audioTestChannels
+	}
+	for i := range spec.Tests {
+		test := &spec.Tests[i]
+		if test.Name == "" {
+			test.Name = fmt.Sprintf("test %d", i+1)
+		}
+		if test.Duration == 0 {
+			test.Duration = audioTestDuration
+		}
+		if test.Expect.Tolerance == 0 {
+			test.Expect.Tolerance = audioTestTolerance
+		}
+	}
+	return spec, nil
+}
+
+// check checks the values of a test that the defaults do not cover.
+func (test audioTest) check(def *sc.Synthdef, opts renderOptions) error {
+	if err := opts.check(); err != nil {
+		return err
+	}
+	if test.Release != nil && !hasParam(def, gateParam) {
+		return errors.Errorf("release needs a %s param, %s has none", gateParam, def.Name)
+	}
+	// A silentAfter at or past the end of the render would check an empty tail.
+	if s := test.Expect.SilentAfter; s != nil && !(*s >= 0 && *s < opts.Duration) {
+		return errors.Errorf("silentAfter is %g, expected a time from 0 to before the end of the %gs render", *s, opts.Duration)
+	}
+	return nil
+}
+
+// signalLevels are the levels of a rendered signal.
+type signalLevels struct {
+	Peak      float64
+	RMS       float64
+	NonFinite int
+}
+
+// measureLevels measures the levels of every channel together, starting at a frame.
+// NaN and infinite samples are counted but left out of the peak and RMS.
+func measureLevels(channels [][]float32, from int) signalLevels {
+	var (
+		levels signalLevels
+		sum    float64
+		n      int
+	)
+	for _, ch := range channels {
+		for i := from; i < len(ch); i++ {
+			v := float64(ch[i])
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				levels.NonFinite++
+				continue
+			}
+			levels.Peak = math.Max(levels.Peak, math.Abs(v))
+			sum += v * v
+			n++
+		}
+	}
+	if n > 0 {
+		levels.RMS = math.Sqrt(sum / float64(n))
+	}
+	return levels
+}
+
+// ampDB converts an amplitude to dBFS.
+func ampDB(amp float64) float64 {
+	return 20 * math.Log10(amp)
+}
+
+// audioTestResult is the result of a single audio test.
+type audioTestResult struct {
+	Name     string   `json:"name"`
+	Time     float64  `json:"time"`
+	Failures []string `json:"failures"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// audioTestSuite is the results of the tests of a spec.
+type audioTestSuite struct {
+	Spec     string            `json:"spec"`
+	Synthdef string            `json:"synthdef"`
+	Results  []audioTestResult `json:"results"`
+}
+
+// runAudioTests runs the tests of a spec. If update is true, golden files are
+// written from the render instead of being compared to it.
+func runAudioTests(path string, update bool) (audioTestSuite, error) {
+	suite := audioTestSuite{Spec: path, Results: []audioTestResult{}}
+
+	spec, err := readAudioTestSpec(path)
+	if err != nil {
+		return suite, err
+	}
+	var (
+		dir          = filepath.Dir(path)
+		synthdefPath = filepath.Join(dir, spec.Synthdef)
+	)
+	suite.Synthdef = synthdefPath
+
+	def, err := readSynthdefFile(synthdefPath)
+	if err != nil {
+		return suite, err
+	}
+	for _, test := range spec.Tests {
+		var (
+			start  = time.Now()
+			result = audioTestResult{Name: test.Name, Failures: []string{}}
+			opts   = renderOptions{
+				SampleRate: spec.SampleRate,
+				BlockSize:  spec.BlockSize,
+				Duration:   test.Duration,
+				Channels:   spec.Channels,
+				Params:     test.Params,
+				Release:    -1,
+				Seed:       spec.Seed,
+			}
+		)
+		if test.Release != nil {
+			opts.Release = *test.Release
+		}
+		if err := test.check(def, opts); err != nil {
+			result.Error = err.Error()
+		} else if r, err := newRenderer(def, opts); err != nil {
+			result.Error = err.Error()
+		} else {
+			channels := r.render()
+			result.Failures, err = checkAudioExpect(test.Expect, dir, opts, channels, update)
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}
+		result.Time = time.Since(start).Seconds()
+		suite.Results = append(suite.Results, result)
+	}
+	return suite, nil
+}
+
+// checkAudioExpect checks a render against the expectations of a test and returns a description of every failure.
+func checkAudioExpect(expect audioExpect, dir string, opts renderOptions, channels [][]float32, update bool) ([]string, error) {
+	var (
+		failures = []string{}
+		levels   = measureLevels(channels, 0)
+	)
+	if expect.Finite && levels.NonFinite > 0 {
+		failures = append(failures, fmt.Sprintf("%d samples are NaN or infinite", levels.NonFinite))
+	}
+	if expect.PeakBelow != nil && ampDB(levels.Peak) >= *expect.PeakBelow {
+		failures = append(failures, fmt.Sprintf("peak is %.2f dBFS, expected below %g dBFS", ampDB(levels.Peak), *expect.PeakBelow))
+	}
+	if expect.RMSAbove != nil && ampDB(levels.RMS) <= *expect.RMSAbove {
+		failures = append(failures, fmt.Sprintf("RMS is %.2f dBFS, expected above %g dBFS", ampDB(levels.RMS), *expect.RMSAbove))
+	}
+	if expect.RMSBelow != nil && ampDB(levels.RMS) >= *expect.RMSBelow {
+		failures = append(failures, fmt.Sprintf("RMS is %.2f dBFS, expected below %g dBFS", ampDB(levels.RMS), *expect.RMSBelow))
+	}
+	if expect.SilentAfter != nil {
+		threshold := float64(audioTestSilenceBelow)
+		if expect.SilenceBelow != nil {
+			threshold = *expect.SilenceBelow
+		}
+		tail := measureLevels(channels, int(*expect.SilentAfter*opts.SampleRate))
+		if ampDB(tail.Peak) >= threshold || tail.NonFinite > 0 {
+			failures = append(failures, fmt.Sprintf("peak after %gs is %.2f dBFS, expected silence below %g dBFS", *expect.SilentAfter, ampDB(tail.Peak), threshold))
+		}
+	}
+	if expect.Golden == "" {
+		return failures, nil
+	}
+	golden := filepath.Join(dir, expect.Golden)
+	if update {
+		return failures, writeWAVFile(golden, int(opts.SampleRate), 32, channels)
+	}
+	sampleRate, want, err := readWAVFile(golden)
+	if err != nil {
+		return failures, err
+	}
+	if failure := compareGolden(channels, want, int(opts.SampleRate), sampleRate, expect.Tolerance); failure != "" {
+		failures = append(failures, fmt.Sprintf("%s: %s", expect.Golden, failure))
+	}
+	return failures, nil
+}
+
+// compareGolden compares a render to a golden file and describes the first difference,
+// or returns the empty string if they match.
+func compareGolden(got, want [][]float32, gotRate, wantRate int, tolerance float64) string {
+	if gotRate != wantRate {
+		return fmt.Sprintf("sample rate is %d, golden is %d", gotRate, wantRate)
+	}
+	if len(got) != len(want) {
+		return fmt.Sprintf("%d channels, golden has %d", len(got), len(want))
+	}
+	var (
+		worst   float64
+		worstAt int
+	)
+	for ch := range got {
+		if len(got[ch]) != len(want[ch]) {
+			return fmt.Sprintf("%d frames, golden has %d", len(got[ch]), len(want[ch]))
+		}
+		for i := range got[ch] {
+			if d := math.Abs(float64(got[ch][i] - want[ch][i])); d > worst || math.IsNaN(d) {
+				worst, worstAt = d, i
+			}
+		}
+	}
+	if worst > tolerance || math.IsNaN(worst) {
+		return fmt.Sprintf("differs by up to %.4g at %.4fs, tolerance is %g", worst, float64(worstAt)/float64(gotRate), tolerance)
+	}
+	return ""
+}
+
+// testCmd runs the test command
+func (c *controller) testCmd() error {
+	fset := c.flagSets["test"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one test spec")
+	}
+	var (
+		suites        = []audioTestSuite{}
+		tests, failed = 0, 0
+	)
+	for _, path := range fset.Args() {
+		suite, err := runAudioTests(path, *c.testUpdate)
+		if err != nil {
+			return err
+		}
+		for _, result := range suite.Results {
+			tests++
+			if len(result.Failures) > 0 || result.Error != "" {
+				failed++
+			}
+		}
+		suites = append(suites, suite)
+	}
+	var err error
+	switch *c.testOutput {
+	case "json":
+		err = writeJSON(os.Stdout, suites)
+	case "junit":
+		err = writeJUnit(os.Stdout, suites)
+	case "text":
+		err = writeAudioTests(os.Stdout, suites)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.testOutput)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d audio test(s) failed", failed, tests)
+	}
+	return nil
+}
+
+// writeAudioTests writes human-readable test results.
+func writeAudioTests(w io.Writer, suites []audioTestSuite) error {
+	for _, suite := range suites {
+		fmt.Fprintf(w, "%s (%s)\n", suite.Spec, suite.Synthdef)
+		for _, result := range suite.Results {
+			switch {
+			case result.Error != "":
+				fmt.Fprintf(w, "  ERROR %s: %s\n", result.Name, result.Error)
+			case len(result.Failures) > 0:
+				fmt.Fprintf(w, "  FAIL  %s\n", result.Name)
+				for _, failure := range result.Failures {
+					fmt.Fprintf(w, "        %s\n", failure)
+				}
+			default:
+				fmt.Fprintf(w, "  PASS  %s (%.3fs)\n", result.Name, result.Time)
+			}
+		}
+	}
+	return nil
+}
+
+// JUnit XML report, as read by most CI servers.
+type (
+	junitTestSuites struct {
+		XMLName xml.Name         `xml:"testsuites"`
+		Suites  []junitTestSuite `xml:"testsuite"`
+	}
+	junitTestSuite struct {
+		Name     string          `xml:"name,attr"`
+		Tests    int             `xml:"tests,attr"`
+		Failures int             `xml:"failures,attr"`
+		Errors   int             `xml:"errors,attr"`
+		Time     float64         `xml:"time,attr"`
+		Cases    []junitTestCase `xml:"testcase"`
+	}
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Time      float64       `xml:"time,attr"`
+		Failure   *junitMessage `xml:"failure,omitempty"`
+		Error     *junitMessage `xml:"error,omitempty"`
+	}
+	junitMessage struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// writeJUnit writes test results as JUnit XML.
+func writeJUnit(w io.Writer, suites []audioTestSuite) error {
+	report := junitTestSuites{}
+	for _, suite := range suites {
+		js := junitTestSuite{Name: suite.Spec, Tests: len(suite.Results)}
+		for _, result := range suite.Results {
+			tc := junitTestCase{Name: result.Name, Classname: suite.Synthdef, Time: result.Time}
+			switch {
+			case result.Error != "":
+				tc.Error = &junitMessage{Message: result.Error}
+				js.Errors++
+			case len(result.Failures) > 0:
+				text := ""
+				for _, failure := range result.Failures {
+					text += failure + "\n"
+				}
+				tc.Failure = &junitMessage{Message: result.Failures[0], Text: text}
+				js.Failures++
+			}
+			js.Time += result.Time
+			js.Cases = append(js.Cases, tc)
+		}
+		report.Suites = append(report.Suites, js)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// Buffer access modes.
+const (
+	bufferRead     = "read"
+	bufferWrite    = "write"
+	bufferInfo     = "info"
+	bufferAllocate = "allocate"
+)
+
+// bufferInput is a ugen input that carries a buffer number.
+type bufferInput struct {
+	index int
+	name  string
+	// mono is true if the ugen expects a single-channel buffer.
+	mono bool
+}
+
+// bufferUgen describes how a ugen uses buffers.
+type bufferUgen struct {
+	mode   string
+	inputs []bufferInput
+	// channels returns the number of buffer channels the ugen expects,
+	// or 0 if the ugen does not imply a channel count.
+	channels func(u *sc.Ugen) int
+}
+
+// numOutputs is the channel count of ugens that output one channel per buffer channel.
+func numOutputs(u *sc.Ugen) int {
+	return len(u.Outputs)
+}
+
+// trailingInputs returns a func that computes the channel count of ugens that
+// write every input after the first n inputs to a buffer.
+func trailingInputs(n int) func(u *sc.Ugen) int {
+	return func(u *sc.Ugen) int {
+		return len(u.Inputs) - n
+	}
+}
+
+// bufnum is the buffer input of most of the buffer ugens.
+var bufnum = []bufferInput{{index: 0, name: "bufnum"}}
+
+// monoBufnum is the buffer input of ugens that expect a single-channel buffer.
+var monoBufnum = []bufferInput{{index: 0, name: "bufnum", mono: true}}
+
+// bufferUgens contains the ugens that read, write, or allocate buffers.
+// Phase vocoder ugens (PV_*) are handled by lookupBufferUgen.
+var bufferUgens = map[string]bufferUgen{
+	"BufAllpassC":   {mode: bufferWrite, inputs: monoBufnum},
+	"BufAllpassL":   {mode: bufferWrite, inputs: monoBufnum},
+	"BufAllpassN":   {mode: bufferWrite, inputs: monoBufnum},
+	"BufChannels":   {mode: bufferInfo, inputs: bufnum},
+	"BufCombC":      {mode: bufferWrite, inputs: monoBufnum},
+	"BufCombL":      {mode: bufferWrite, inputs: monoBufnum},
+	"BufCombN":      {mode: bufferWrite, inputs: monoBufnum},
+	"BufDelayC":     {mode: bufferWrite, inputs: monoBufnum},
+	"BufDelayL":     {mode: bufferWrite, inputs: monoBufnum},
+	"BufDelayN":     {mode: bufferWrite, inputs: monoBufnum},
+	"BufDur":        {mode: bufferInfo, inputs: bufnum},
+	"BufFrames":     {mode: bufferInfo, inputs: bufnum},
+	"BufRateScale":  {mode: bufferInfo, inputs: bufnum},
+	"BufRd":         {mode: bufferRead, inputs: bufnum, channels: numOutputs},
+	"BufSampleRate": {mode: bufferInfo, inputs: bufnum},
+	"BufSamples":    {mode: bufferInfo, inputs: bufnum},
+	"BufWr":         {mode: bufferWrite, inputs: bufnum, channels: trailingInputs(3)},
+	"COsc":          {mode: bufferRead, inputs: monoBufnum},
+	"Convolution2":  {mode: bufferRead, inputs: []bufferInput{{index: 1, name: "kernel", mono: true}}},
+	"DetectIndex":   {mode: bufferRead, inputs: monoBufnum},
+	"DiskIn":        {mode: bufferRead, inputs: bufnum, channels: numOutputs},
+	"DiskOut":       {mode: bufferWrite, inputs: bufnum, channels: trailingInputs(1)},
+	"FFT":           {mode: bufferWrite, inputs: []bufferInput{{index: 0, name: "buffer", mono: true}}},
+	"FoldIndex":     {mode: bufferRead, inputs: monoBufnum},
+	"GrainBuf": {mode: bufferRead, inputs: []bufferInput{
+		{index: 2, name: "sndbuf", mono: true},
+		{index: 7, name: "envbufnum", mono: true},
+	}},
+	"IFFT":           {mode: bufferRead, inputs: []bufferInput{{index: 0, name: "buffer", mono: true}}},
+	"Index":          {mode: bufferRead, inputs: monoBufnum},
+	"IndexInBetween": {mode: bufferRead, inputs: monoBufnum},
+	"IndexL":         {mode: bufferRead, inputs: monoBufnum},
+	"LocalBuf":       {mode: bufferAllocate},
+	"Osc":            {mode: bufferRead, inputs: monoBufnum},
+	"OscN":           {mode: bufferRead, inputs: monoBufnum},
+	"PartConv":       {mode: bufferRead, inputs: []bufferInput{{index: 2, name: "irbufnum", mono: true}}},
+	"PlayBuf":        {mode: bufferRead, inputs: bufnum, channels: numOutputs},
+	"RecordBuf":      {mode: bufferWrite, inputs: bufnum, channels: trailingInputs(8)},
+	"Shaper":         {mode: bufferRead, inputs: monoBufnum},
+	"TGrains":        {mode: bufferRead, inputs: []bufferInput{{index: 1, name: "bufnum", mono: true}}},
+	"VDiskIn":        {mode: bufferRead, inputs: bufnum, channels: numOutputs},
+	"VOsc":           {mode: bufferRead, inputs: []bufferInput{{index: 0, name: "bufpos", mono: true}}},
+	"VOsc3":          {mode: bufferRead, inputs: []bufferInput{{index: 0, name: "bufpos", mono: true}}},
+	"Warp1": {mode: bufferRead, inputs: []bufferInput{
+		{index: 0, name: "bufnum"},
+		{index: 4, name: "envbufnum", mono: true},
+	}, channels: numOutputs},
+	"WrapIndex": {mode: bufferRead, inputs: monoBufnum},
+}
+
+// lookupBufferUgen returns the buffer usage of a ugen.
+func lookupBufferUgen(name string) (bufferUgen, bool) {
+	if strings.HasPrefix(name, "PV_") {
+		return bufferUgen{mode: bufferWrite, inputs: []bufferInput{{index: 0, name: "buffer", mono: true}}}, true
+	}
+	bu, ok := bufferUgens[name]
+	return bu, ok
+}
+
+// bufferUse is a ugen input that carries a buffer number.
+type bufferUse struct {
+	Ugen      string      `json:"ugen"`
+	UgenIndex int         `json:"ugenIndex"`
+	Mode      string      `json:"mode"`
+	Input     string      `json:"input,omitempty"`
+	Buffer    inputSource `json:"buffer"`
+	Channels  int         `json:"channels,omitempty"`
+}
+
+// String returns a one-line description of the buffer use.
+func (bu bufferUse) String() string {
+	var (
+		ugen     = fmt.Sprintf("%s(%d)", bu.Ugen, bu.UgenIndex)
+		channels = "-"
+	)
+	if bu.Channels > 0 {
+		channels = fmt.Sprintf("%dch", bu.Channels)
+	}
+	if bu.Mode == bufferAllocate {
+		return fmt.Sprintf("%-8s %-20s %-10s %5s", bu.Mode, ugen, "", channels)
+	}
+	return fmt.Sprintf("%-8s %-20s %-10s %5s  %s", bu.Mode, ugen, bu.Input, channels, describeSource(bu.Buffer))
+}
+
+// bufferUses returns every use of a buffer in a synthdef, in ugen order.
+func bufferUses(def *sc.Synthdef) []bufferUse {
+	uses := []bufferUse{}
+
+	for i, u := range def.Ugens {
+		bu, ok := lookupBufferUgen(u.Name)
+		if !ok {
+			continue
+		}
+		if bu.mode == bufferAllocate {
+			uses = append(uses, bufferUse{
+				Ugen:      u.Name,
+				UgenIndex: i,
+				Mode:      bu.mode,
+				Buffer:    inputSource{Kind: sourceUgen, Ugen: u.Name, UgenIndex: int32(i)},
+				Channels:  localBufChannels(def, u),
+			})
+			continue
+		}
+		for _, in := range bu.inputs {
+			if in.index >= len(u.Inputs) {
+				continue
+			}
+			use := bufferUse{
+				Ugen:      u.Name,
+				UgenIndex: i,
+				Mode:      bu.mode,
+				Input:     in.name,
+				Buffer:    describeInput(def, u.Inputs[in.index]),
+			}
+			if in.mono {
+				use.Channels = 1
+			} else if bu.channels != nil {
+				use.Channels = bu.channels(u)
+			}
+			uses = append(uses, use)
+		}
+	}
+	return uses
+}
+
+// localBufChannels returns the number of channels of a LocalBuf,
+// or 0 if it is not a constant.
+func localBufChannels(def *sc.Synthdef, u *sc.Ugen) int {
+	if len(u.Inputs) == 0 || !u.Inputs[0].IsConstant() {
+		return 0
+	}
+	return int(def.Constants[u.Inputs[0].OutputIndex])
+}
+
+// bufferKey returns the key that identifies the buffer of a buffer use.
+// Constant buffer numbers are identified by their number and params by their name.
+// The second return value is false if the buffer number is computed by a ugen.
+func bufferKey(src inputSource) (string, bool) {
+	switch src.Kind {
+	case sourceConstant:
+		return strconv.FormatFloat(float64(src.Value), 'g', -1, 32), true
+	case sourceParam:
+		return src.Param, true
+	}
+	return "", false
+}
+
+// bufferMismatches compares the channel counts that ugens expect with the
+// actual channel counts of buffers, which are keyed by buffer number or param name.
+// It also reports buffers that different ugens expect to have different channel counts.
+func bufferMismatches(def *sc.Synthdef, uses []bufferUse, actual map[string]float32) []string {
+	var (
+		mismatches = []string{}
+		expected   = map[string]bufferUse{}
+	)
+	for _, use := range uses {
+		// Negative buffer numbers mean "no buffer", e.g. GrainBuf's built-in envelope.
+		if use.Channels == 0 || (use.Buffer.Kind == sourceConstant && use.Buffer.Value < 0) {
+			continue
+		}
+		key, ok := bufferKey(use.Buffer)
+		if !ok {
+			// Compare against the channel count of a LocalBuf.
+			if use.Buffer.Ugen != "LocalBuf" || use.Mode == bufferAllocate {
+				continue
+			}
+			n := localBufChannels(def, def.Ugens[use.Buffer.UgenIndex])
+			if n > 0 && n != use.Channels {
+				mismatches = append(mismatches, fmt.Sprintf("%s(%d) expects %d channel(s), LocalBuf(%d) has %d", use.Ugen, use.UgenIndex, use.Channels, use.Buffer.UgenIndex, n))
+			}
+			continue
+		}
+		if n, ok := actual[key]; ok && int(n) != use.Channels {
+			mismatches = append(mismatches, fmt.Sprintf("%s(%d) expects buffer %s to have %d channel(s), it has %d", use.Ugen, use.UgenIndex, key, use.Channels, int(n)))
+		}
+		if prev, ok := expected[key]; ok && prev.Channels != use.Channels {
+			mismatches = append(mismatches, fmt.Sprintf("%s(%d) expects buffer %s to have %d channel(s), %s(%d) expects %d", use.Ugen, use.UgenIndex, key, use.Channels, prev.Ugen, prev.UgenIndex, prev.Channels))
+			continue
+		}
+		expected[key] = use
+	}
+	return mismatches
+}
+
+// synthdefBuffers is the buffer report for a single synthdef file.
+type synthdefBuffers struct {
+	File       string      `json:"file"`
+	Synthdef   string      `json:"synthdef"`
+	Buffers    []bufferUse `json:"buffers"`
+	Mismatches []string    `json:"mismatches,omitempty"`
+}
+
+// buffers runs the buffers command
+func (c *controller) buffers() error {
+	fset := c.flagSets["buffers"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file")
+	}
+	var (
+		reports    = []synthdefBuffers{}
+		mismatches = 0
+	)
+	for _, path := range fset.Args() {
+		def, err := readSynthdefFile(path)
+		if err != nil {
+			return err
+		}
+		uses := bufferUses(def)
+		report := synthdefBuffers{
+			File:       path,
+			Synthdef:   def.Name,
+			Buffers:    uses,
+			Mismatches: bufferMismatches(def, uses, c.buffersChannels),
+		}
+		mismatches += len(report.Mismatches)
+		reports = append(reports, report)
+	}
+	var err error
+	switch *c.buffersOutput {
+	case "json":
+		err = writeJSON(os.Stdout, reports)
+	case "text":
+		err = writeBuffers(os.Stdout, reports)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.buffersOutput)
+	}
+	if err != nil {
+		return err
+	}
+	if mismatches > 0 {
+		return errors.Errorf("found %d buffer channel mismatch(es)", mismatches)
+	}
+	return nil
+}
+
+// writeBuffers writes a human-readable buffer report.
+func writeBuffers(w io.Writer, reports []synthdefBuffers) error {
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s (%s)\n", report.File, report.Synthdef)
+		if len(report.Buffers) == 0 {
+			fmt.Fprintf(w, "  no buffers\n")
+		}
+		for _, use := range report.Buffers {
+			fmt.Fprintf(w, "  %s\n", use)
+		}
+		for _, mismatch := range report.Mismatches {
+			fmt.Fprintf(w, "  mismatch: %s\n", mismatch)
+		}
+	}
+	return nil
+}
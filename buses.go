@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// Bus access directions.
+const (
+	busRead  = "read"
+	busWrite = "write"
+)
+
+// busUgen describes how a ugen accesses a bus.
+type busUgen struct {
+	// write is true if the ugen writes to a bus, false if it reads from one.
+	write bool
+	// local is true if the bus is local to the synth (LocalIn/LocalOut).
+	local bool
+	// audio is true if the ugen always accesses audio buses, regardless of its rate.
+	audio bool
+	// busInput is the index of the input that carries the bus index,
+	// or -1 if the ugen does not have a bus input.
+	busInput int
+	// firstChannel is the index of the first input that is written to the bus.
+	firstChannel int
+}
+
+// busUgens contains all the ugens that read from or write to buses.
+var busUgens = map[string]busUgen{
+	"In":         {busInput: 0},
+	"InFeedback": {busInput: 0, audio: true},
+	"InTrig":     {busInput: 0},
+	"LagIn":      {busInput: 0},
+	"LocalIn":    {busInput: -1, local: true},
+	"LocalOut":   {busInput: -1, local: true, write: true},
+	"OffsetOut":  {busInput: 0, write: true, firstChannel: 1},
+	"Out":        {busInput: 0, write: true, firstChannel: 1},
+	"ReplaceOut": {busInput: 0, write: true, firstChannel: 1},
+	"XOut":       {busInput: 0, write: true, firstChannel: 2},
+}
+
+// busAccess is a single read from or write to a bus.
+type busAccess struct {
+	Ugen      string       `json:"ugen"`
+	UgenIndex int          `json:"ugenIndex"`
+	Direction string       `json:"direction"`
+	Rate      string       `json:"rate"`
+	Channels  int          `json:"channels"`
+	Local     bool         `json:"local,omitempty"`
+	Bus       *inputSource `json:"bus,omitempty"`
+}
+
+// String returns a one-line description of the bus access.
+func (ba busAccess) String() string {
+	bus := "local"
+	if ba.Bus != nil {
+		bus = "bus: " + ba.Bus.String()
+	}
+	return fmt.Sprintf("%-6s %-8s %3dch  %-20s %s", ba.Direction, ba.Rate, ba.Channels, fmt.Sprintf("%s(%d)", ba.Ugen, ba.UgenIndex), bus)
+}
+
+// busAccesses returns every bus read and write in a synthdef, in ugen order.
+func busAccesses(def *sc.Synthdef) []busAccess {
+	accesses := []busAccess{}
+
+	for i, u := range def.Ugens {
+		bu, ok := busUgens[u.Name]
+		if !ok {
+			continue
+		}
+		ba := busAccess{
+			Ugen:      u.Name,
+			UgenIndex: i,
+			Direction: busRead,
+			Rate:      rateName(sc.KR),
+			Channels:  len(u.Outputs),
+			Local:     bu.local,
+		}
+		if u.Rate == sc.AR || bu.audio {
+			ba.Rate = rateName(sc.AR)
+		}
+		if bu.write {
+			ba.Direction = busWrite
+			ba.Channels = len(u.Inputs) - bu.firstChannel
+		}
+		if bu.busInput >= 0 && bu.busInput < len(u.Inputs) {
+			src := describeInput(def, u.Inputs[bu.busInput])
+			ba.Bus = &src
+		}
+		accesses = append(accesses, ba)
+	}
+	return accesses
+}
+
+// synthdefBuses is the bus report for a single synthdef file.
+type synthdefBuses struct {
+	File     string      `json:"file"`
+	Synthdef string      `json:"synthdef"`
+	Buses    []busAccess `json:"buses"`
+}
+
+// buses runs the buses command
+func (c *controller) buses() error {
+	fset := c.flagSets["buses"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file")
+	}
+	reports := []synthdefBuses{}
+
+	for _, path := range fset.Args() {
+		def, err := readSynthdefFile(path)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, synthdefBuses{
+			File:     path,
+			Synthdef: def.Name,
+			Buses:    busAccesses(def),
+		})
+	}
+	switch *c.busesOutput {
+	case "json":
+		return writeJSON(os.Stdout, reports)
+	case "text":
+		return writeBuses(os.Stdout, reports)
+	default:
+		return errors.Errorf("unsupported output format %q", *c.busesOutput)
+	}
+}
+
+// writeBuses writes a human-readable bus report.
+func writeBuses(w io.Writer, reports []synthdefBuses) error {
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s (%s)\n", report.File, report.Synthdef)
+		if len(report.Buses) == 0 {
+			fmt.Fprintf(w, "  no bus access\n")
+			continue
+		}
+		for _, ba := range report.Buses {
+			fmt.Fprintf(w, "  %s\n", ba)
+		}
+	}
+	return nil
+}
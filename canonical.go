@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// commutativeBinaryOps contains the special indices of the BinaryOpUGen operators
+// whose operands can be swapped without changing the result.
+var commutativeBinaryOps = map[int16]bool{
+	0:  true, // +
+	2:  true, // *
+	6:  true, // ==
+	7:  true, // !=
+	12: true, // min
+	13: true, // max
+	14: true, // bitAnd
+	15: true, // bitOr
+	16: true, // bitXor
+	17: true, // lcm
+	18: true, // gcd
+	23: true, // hypot
+	24: true, // hypotApx
+	35: true, // sumsqr
+	36: true, // sqrsum
+	38: true, // absdif
+}
+
+// isCommutative returns true if the inputs of a ugen can be reordered without changing its output.
+func isCommutative(u *sc.Ugen) bool {
+	switch u.Name {
+	case "BinaryOpUGen":
+		return commutativeBinaryOps[u.SpecialIndex]
+	case "Sum3", "Sum4":
+		return true
+	}
+	return false
+}
+
+// isOrdered returns true if the position of a ugen relative to other ordered ugens matters.
+// This is the case for ugens with side effects, ugens that read buses or buffers
+// (which other ugens of the same synth might write), and ugens that are not in the catalog.
+func isOrdered(cat ugenCatalog, u *sc.Ugen) bool {
+	if _, ok := busUgens[u.Name]; ok {
+		return true
+	}
+	if _, ok := lookupBufferUgen(u.Name); ok {
+		return true
+	}
+	spec, ok := cat[u.Name]
+	return !ok || spec.SideEffects
+}
+
+// canonicalizer computes the canonical form of a synthdef.
+type canonicalizer struct {
+	def       *sc.Synthdef
+	cat       ugenCatalog
+	consumers [][]int
+	up        []string // signatures of the ugens and everything upstream of them
+	down      []string // signatures of everything downstream of the ugens
+}
+
+// canonicalize returns a copy of a synthdef in a deterministic form:
+//   - ugens are in a topological order that only depends on the structure of the graph,
+//     with control ugens first and ordered ugens (see isOrdered) kept in their original order
+//   - the operands of commutative ugens are sorted
+//   - constants are sorted by first use, and unused constants are dropped
+//
+// Synthdefs that only differ in the order they were emitted in have the same canonical form.
+// Ugens whose signatures are identical both upstream and downstream keep their original order.
+func canonicalize(def *sc.Synthdef, cat ugenCatalog) (*sc.Synthdef, error) {
+	cz := &canonicalizer{
+		def:       def,
+		cat:       cat,
+		consumers: make([][]int, len(def.Ugens)),
+		up:        make([]string, len(def.Ugens)),
+		down:      make([]string, len(def.Ugens)),
+	}
+	for i, u := range def.Ugens {
+		for _, in := range u.Inputs {
+			if in.IsConstant() {
+				continue
+			}
+			if in.UgenIndex < 0 || int(in.UgenIndex) >= len(def.Ugens) {
+				return nil, errors.Errorf("%s(%d) has an input from missing ugen %d", u.Name, i, in.UgenIndex)
+			}
+			cz.consumers[in.UgenIndex] = append(cz.consumers[in.UgenIndex], i)
+		}
+	}
+	for i := range def.Ugens {
+		if _, err := cz.upSignature(i, map[int]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	for i := range def.Ugens {
+		cz.downSignature(i)
+	}
+	order, err := cz.order()
+	if err != nil {
+		return nil, err
+	}
+	return cz.rewrite(order), nil
+}
+
+// signature returns the hex-encoded SHA-256 of a list of strings.
+func signature(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// inputSignature returns the signature of a single ugen input.
+func (cz *canonicalizer) inputSignature(in sc.UgenInput) string {
+	if in.IsConstant() {
+		return fmt.Sprintf("c%08x", math.Float32bits(cz.def.Constants[in.OutputIndex]))
+	}
+	return fmt.Sprintf("u%s:%d", cz.up[in.UgenIndex], in.OutputIndex)
+}
+
+// upSignature computes the signature of a ugen from its own properties and the signatures of its inputs.
+// The inputs of commutative ugens are sorted so that their order does not matter.
+func (cz *canonicalizer) upSignature(i int, visiting map[int]bool) (string, error) {
+	if cz.up[i] != "" {
+		return cz.up[i], nil
+	}
+	if visiting[i] {
+		return "", errors.Errorf("ugen graph has a cycle at %s(%d)", cz.def.Ugens[i].Name, i)
+	}
+	visiting[i] = true
+
+	u := cz.def.Ugens[i]
+	inputs := make([]string, len(u.Inputs))
+	for ii, in := range u.Inputs {
+		if !in.IsConstant() {
+			if _, err := cz.upSignature(int(in.UgenIndex), visiting); err != nil {
+				return "", err
+			}
+		}
+		inputs[ii] = cz.inputSignature(in)
+	}
+	if isCommutative(u) {
+		sort.Strings(inputs)
+	}
+	outputs := make([]string, len(u.Outputs))
+	for oi, out := range u.Outputs {
+		outputs[oi] = fmt.Sprint(out)
+	}
+	cz.up[i] = signature(u.Name, fmt.Sprint(u.Rate), fmt.Sprint(u.SpecialIndex), strings.Join(outputs, ","), strings.Join(inputs, ","))
+	return cz.up[i], nil
+}
+
+// downSignature computes the signature of everything that consumes the outputs of a ugen.
+func (cz *canonicalizer) downSignature(i int) string {
+	if cz.down[i] != "" {
+		return cz.down[i]
+	}
+	uses := []string{}
+	for _, ci := range cz.consumers[i] {
+		consumer := cz.def.Ugens[ci]
+		for ii, in := range consumer.Inputs {
+			if in.IsConstant() || int(in.UgenIndex) != i {
+				continue
+			}
+			if isCommutative(consumer) {
+				ii = 0
+			}
+			uses = append(uses, fmt.Sprintf("%s:%d:%d:%s", cz.up[ci], ii, in.OutputIndex, cz.downSignature(ci)))
+		}
+	}
+	sort.Strings(uses)
+	cz.down[i] = signature(uses...)
+	return cz.down[i]
+}
+
+// order returns the canonical order of the ugens, as indices into the original ugens.
+func (cz *canonicalizer) order() ([]int, error) {
+	var (
+		n        = len(cz.def.Ugens)
+		indegree = make([]int, n)
+		after    = make([][]int, n)
+		order    = make([]int, 0, n)
+		done     = make([]bool, n)
+		previous = -1
+	)
+	for i, u := range cz.def.Ugens {
+		for _, in := range u.Inputs {
+			if !in.IsConstant() {
+				after[in.UgenIndex] = append(after[in.UgenIndex], i)
+				indegree[i]++
+			}
+		}
+		if isOrdered(cz.cat, u) {
+			if previous >= 0 {
+				after[previous] = append(after[previous], i)
+				indegree[i]++
+			}
+			previous = i
+		}
+	}
+	for len(order) < n {
+		next := -1
+		for i := 0; i < n; i++ {
+			if done[i] || indegree[i] > 0 {
+				continue
+			}
+			if next == -1 || cz.less(i, next) {
+				next = i
+			}
+		}
+		if next == -1 {
+			return nil, errors.New("ugen graph has a cycle")
+		}
+		done[next] = true
+		order = append(order, next)
+		for _, j := range after[next] {
+			indegree[j]--
+		}
+	}
+	return order, nil
+}
+
+// less returns true if ugen i should come before ugen j when both are ready to be placed.
+func (cz *canonicalizer) less(i, j int) bool {
+	ui, uj := cz.def.Ugens[i], cz.def.Ugens[j]
+	_, ci := controlNames[ui.Name]
+	_, cj := controlNames[uj.Name]
+
+	switch {
+	case ci && !cj:
+		return true
+	case cj && !ci:
+		return false
+	case ci && cj:
+		return ui.SpecialIndex < uj.SpecialIndex
+	}
+	if cz.up[i] != cz.up[j] {
+		return cz.up[i] < cz.up[j]
+	}
+	if cz.down[i] != cz.down[j] {
+		return cz.down[i] < cz.down[j]
+	}
+	return i < j
+}
+
+// rewrite creates the canonical synthdef from the canonical ugen order.
+func (cz *canonicalizer) rewrite(order []int) *sc.Synthdef {
+	var (
+		def       = cz.def
+		newIndex  = make([]int32, len(def.Ugens))
+		constants = map[uint32]int32{}
+		out       = &sc.Synthdef{
+			Name:               def.Name,
+			Constants:          []float32{},
+			InitialParamValues: def.InitialParamValues,
+			ParamNames:         def.ParamNames,
+			Ugens:              make([]*sc.Ugen, len(order)),
+			Variants:           def.Variants,
+		}
+	)
+	for ni, oi := range order {
+		newIndex[oi] = int32(ni)
+	}
+	for ni, oi := range order {
+		u := def.Ugens[oi]
+		inputs := make([]sc.UgenInput, len(u.Inputs))
+		copy(inputs, u.Inputs)
+		if isCommutative(u) {
+			sort.SliceStable(inputs, func(a, b int) bool {
+				return cz.inputSignature(inputs[a]) < cz.inputSignature(inputs[b])
+			})
+		}
+		for ii, in := range inputs {
+			if !in.IsConstant() {
+				inputs[ii].UgenIndex = newIndex[in.UgenIndex]
+				continue
+			}
+			value := def.Constants[in.OutputIndex]
+			idx, ok := constants[math.Float32bits(value)]
+			if !ok {
+				idx = int32(len(out.Constants))
+				constants[math.Float32bits(value)] = idx
+				out.Constants = append(out.Constants, value)
+			}
+			inputs[ii].OutputIndex = idx
+		}
+		outputs := make([]sc.Output, len(u.Outputs))
+		copy(outputs, u.Outputs)
+		out.Ugens[ni] = &sc.Ugen{
+			Name:         u.Name,
+			Rate:         u.Rate,
+			SpecialIndex: u.SpecialIndex,
+			Inputs:       inputs,
+			Outputs:      outputs,
+		}
+	}
+	return out
+}
+
+// synthdefHash returns the hex-encoded SHA-256 of the canonical form of a synthdef.
+// The synthdef name is left out of the hash if ignoreName is true.
+func synthdefHash(def *sc.Synthdef, cat ugenCatalog, ignoreName bool) (string, error) {
+	canonical, err := canonicalize(def, cat)
+	if err != nil {
+		return "", err
+	}
+	if ignoreName {
+		canonical.Name = ""
+	}
+	buf := &bytes.Buffer{}
+	if err := writeSynthdef(buf, canonical); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalizeCmd runs the canonicalize command
+func (c *controller) canonicalizeCmd() error {
+	fset := c.flagSets["canonicalize"]
+
+	if fset.NArg() != 1 {
+		return errors.New("expected one synthdef file")
+	}
+	cat, err := c.loadCatalog()
+	if err != nil {
+		return err
+	}
+	def, err := readSynthdefFile(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	canonical, err := canonicalize(def, cat)
+	if err != nil {
+		return errors.Wrap(err, "canonicalizing "+fset.Arg(0))
+	}
+	if *c.canonicalizeOutput == "" {
+		return writeSynthdef(os.Stdout, canonical)
+	}
+	return writeSynthdefFile(*c.canonicalizeOutput, canonical)
+}
+
+// hash runs the hash command
+func (c *controller) hash() error {
+	fset := c.flagSets["hash"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file or directory")
+	}
+	cat, err := c.loadCatalog()
+	if err != nil {
+		return err
+	}
+	for _, path := range fset.Args() {
+		entries, err := readSynthdefPath(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			sum, err := synthdefHash(entry.Def, cat, *c.hashIgnoreName)
+			if err != nil {
+				return errors.Wrap(err, "hashing "+entry.Path)
+			}
+			fmt.Printf("%s  %s\n", sum, entry.Path)
+		}
+	}
+	return nil
+}
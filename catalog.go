@@ -0,0 +1,735 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// variableOutputs is the number of outputs of a ugen whose output count
+// depends on how it was created, e.g. In or PlayBuf.
+const variableOutputs = -1
+
+// Ugen spec flags.
+const (
+	stateful = 1 << iota
+	sideEffects
+)
+
+// inputSpec describes a single ugen input.
+// Default is nil if the input has no default value.
+type inputSpec struct {
+	Name    string   `json:"name"`
+	Default *float32 `json:"default,omitempty"`
+}
+
+// ugenSpec describes a ugen.
+type ugenSpec struct {
+	Name   string      `json:"name"`
+	Inputs []inputSpec `json:"inputs"`
+
+	// Variadic is true if the last input can repeat any number of times,
+	// e.g. the channels of Out or the envelope of EnvGen.
+	Variadic bool `json:"variadic,omitempty"`
+
+	// Outputs is the number of outputs, or -1 if it depends on the ugen instance.
+	Outputs int `json:"outputs"`
+
+	// Rates contains the rates the ugen can run at (ir, kr, ar, or dr).
+	Rates []string `json:"rates"`
+
+	// SideEffects is true if the ugen does something besides computing its outputs,
+	// such as writing a bus or buffer, sending a message, or freeing its synth.
+	SideEffects bool `json:"sideEffects,omitempty"`
+
+	// Stateful is true if the outputs of the ugen depend on more than its current inputs.
+	Stateful bool `json:"stateful,omitempty"`
+
+	// Plugin is the name of the plugin library that defines the ugen,
+	// e.g. "OscUGens" for a ugen that ships with scsynth or "MdaUGens" for one that does not.
+	Plugin string `json:"plugin,omitempty"`
+
+	// Since is the first SuperCollider version that includes the ugen, if known.
+	Since string `json:"since,omitempty"`
+}
+
+// newUgenSpec creates a ugen spec from a compact description.
+// rates is a space-separated list of rates, e.g. "ar kr".
+// inputs is a space-separated list of input names with optional defaults,
+// e.g. "in freq=440". A trailing "..." makes the last input variadic.
+func newUgenSpec(name, rates, inputs string, outputs, flags int) ugenSpec {
+	spec := ugenSpec{
+		Name:        name,
+		Inputs:      []inputSpec{},
+		Outputs:     outputs,
+		Rates:       strings.Fields(rates),
+		SideEffects: flags&sideEffects != 0,
+		Stateful:    flags&stateful != 0,
+	}
+	for _, field := range strings.Fields(inputs) {
+		if strings.HasSuffix(field, "...") {
+			field = strings.TrimSuffix(field, "...")
+			spec.Variadic = true
+		}
+		is := inputSpec{Name: field}
+		if i := strings.Index(field, "="); i > 0 {
+			v, err := strconv.ParseFloat(field[i+1:], 32)
+			if err != nil {
+				panic(fmt.Sprintf("bad default for %s input %s", name, field))
+			}
+			def := float32(v)
+			is.Name, is.Default = field[:i], &def
+		}
+		spec.Inputs = append(spec.Inputs, is)
+	}
+	return spec
+}
+
+// coreUgens describes the ugens that ship with scsynth.
+// Inputs are listed in the order they appear in a synthdef, which is not always
+// the order of the sclang arguments (e.g. the doneAction of Duty).
+var coreUgens = []ugenSpec{
+	// Controls and operators.
+	newUgenSpec("AudioControl", "ar", "", variableOutputs, 0),
+	newUgenSpec("Control", "ir kr", "", variableOutputs, 0),
+	newUgenSpec("LagControl", "kr", "lags...", variableOutputs, stateful),
+	newUgenSpec("TrigControl", "kr", "", variableOutputs, stateful),
+	newUgenSpec("BinaryOpUGen", "ir kr ar dr", "a b", 1, 0),
+	newUgenSpec("UnaryOpUGen", "ir kr ar dr", "a", 1, 0),
+	newUgenSpec("MulAdd", "ir kr ar", "in mul=1 add=0", 1, 0),
+	newUgenSpec("Sum3", "ir kr ar", "in0 in1 in2", 1, 0),
+	newUgenSpec("Sum4", "ir kr ar", "in0 in1 in2 in3", 1, 0),
+
+	// Oscillators.
+	newUgenSpec("Blip", "ar kr", "freq=440 numharm=200", 1, stateful),
+	newUgenSpec("COsc", "ar kr", "bufnum freq=440 beats=0.5", 1, stateful),
+	newUgenSpec("Formant", "ar", "fundfreq=440 formfreq=1760 bwfreq=880", 1, stateful),
+	newUgenSpec("FSinOsc", "ar kr", "freq=440 iphase=0", 1, stateful),
+	newUgenSpec("Impulse", "ar kr", "freq=440 phase=0", 1, stateful),
+	newUgenSpec("Klang", "ar", "freqscale=1 freqoffset=0 specifications...", 1, stateful),
+	newUgenSpec("Klank", "ar", "input freqscale=1 freqoffset=0 decayscale=1 specifications...", 1, stateful),
+	newUgenSpec("LFCub", "ar kr", "freq=440 iphase=0", 1, stateful),
+	newUgenSpec("LFGauss", "ar kr", "duration=1 width=0.1 iphase=0 loop=1 doneAction=0", 1, stateful|sideEffects),
+	newUgenSpec("LFPar", "ar kr", "freq=440 iphase=0", 1, stateful),
+	newUgenSpec("LFPulse", "ar kr", "freq=440 iphase=0 width=0.5", 1, stateful),
+	newUgenSpec("LFSaw", "ar kr", "freq=440 iphase=0", 1, stateful),
+	newUgenSpec("LFTri", "ar kr", "freq=440 iphase=0", 1, stateful),
+	newUgenSpec("Osc", "ar kr", "bufnum freq=440 phase=0", 1, stateful),
+	newUgenSpec("OscN", "ar kr", "bufnum freq=440 phase=0", 1, stateful),
+	newUgenSpec("Phasor", "ar kr", "trig=0 rate=1 start=0 end=1 resetPos=0", 1, stateful),
+	newUgenSpec("Pulse", "ar kr", "freq=440 width=0.5", 1, stateful),
+	newUgenSpec("Saw", "ar kr", "freq=440", 1, stateful),
+	newUgenSpec("SinOsc", "ar kr", "freq=440 phase=0", 1, stateful),
+	newUgenSpec("Sweep", "ar kr", "trig=0 rate=1", 1, stateful),
+	newUgenSpec("SyncSaw", "ar kr", "syncFreq=440 sawFreq=440", 1, stateful),
+	newUgenSpec("VarSaw", "ar kr", "freq=440 iphase=0 width=0.5", 1, stateful),
+	newUgenSpec("VOsc", "ar kr", "bufpos freq=440 phase=0", 1, stateful),
+	newUgenSpec("VOsc3", "ar kr", "bufpos freq1=110 freq2=220 freq3=440", 1, stateful),
+
+	// Noise and random numbers.
+	newUgenSpec("BrownNoise", "ar kr", "", 1, stateful),
+	newUgenSpec("ClipNoise", "ar kr", "", 1, stateful),
+	newUgenSpec("CoinGate", "ar kr", "prob in", 1, stateful),
+	newUgenSpec("Crackle", "ar kr", "chaosParam=1.5", 1, stateful),
+	newUgenSpec("Dust", "ar kr", "density=0", 1, stateful),
+	newUgenSpec("Dust2", "ar kr", "density=0", 1, stateful),
+	newUgenSpec("ExpRand", "ir", "lo=0.01 hi=1", 1, stateful),
+	newUgenSpec("GrayNoise", "ar kr", "", 1, stateful),
+	newUgenSpec("Hasher", "ar kr", "in", 1, 0),
+	newUgenSpec("IRand", "ir", "lo=0 hi=127", 1, stateful),
+	newUgenSpec("LFClipNoise", "ar kr", "freq=500", 1, stateful),
+	newUgenSpec("LFDNoise0", "ar kr", "freq=500", 1, stateful),
+	newUgenSpec("LFDNoise1", "ar kr", "freq=500", 1, stateful),
+	newUgenSpec("LFDNoise3", "ar kr", "freq=500", 1, stateful),
+	newUgenSpec("LFNoise0", "ar kr", "freq=500", 1, stateful),
+	newUgenSpec("LFNoise1", "ar kr", "freq=500", 1, stateful),
+	newUgenSpec("LFNoise2", "ar kr", "freq=500", 1, stateful),
+	newUgenSpec("LinRand", "ir", "lo=0 hi=1 minmax=0", 1, stateful),
+	newUgenSpec("NRand", "ir", "lo=0 hi=1 n=0", 1, stateful),
+	newUgenSpec("PinkNoise", "ar kr", "", 1, stateful),
+	newUgenSpec("Rand", "ir", "lo=0 hi=1", 1, stateful),
+	newUgenSpec("RandID", "ir kr", "id=0", 0, sideEffects),
+	newUgenSpec("RandSeed", "ir kr ar", "trig=0 seed=56789", 0, sideEffects),
+	newUgenSpec("TExpRand", "ar kr", "lo=0.01 hi=1 trig=0", 1, stateful),
+	newUgenSpec("TIRand", "ar kr", "lo=0 hi=127 trig=0", 1, stateful),
+	newUgenSpec("TRand", "ar kr", "lo=0 hi=1 trig=0", 1, stateful),
+	newUgenSpec("WhiteNoise", "ar kr", "", 1, stateful),
+
+	// Filters.
+	newUgenSpec("BAllPass", "ar", "in freq=1200 rq=1", 1, stateful),
+	newUgenSpec("BBandPass", "ar", "in freq=1200 bw=1", 1, stateful),
+	newUgenSpec("BBandStop", "ar", "in freq=1200 bw=1", 1, stateful),
+	newUgenSpec("BHiPass", "ar", "in freq=1200 rq=1", 1, stateful),
+	newUgenSpec("BHiShelf", "ar", "in freq=1200 rs=1 db=0", 1, stateful),
+	newUgenSpec("BLowPass", "ar", "in freq=1200 rq=1", 1, stateful),
+	newUgenSpec("BLowShelf", "ar", "in freq=1200 rs=1 db=0", 1, stateful),
+	newUgenSpec("BPeakEQ", "ar", "in freq=1200 rq=1 db=0", 1, stateful),
+	newUgenSpec("BPF", "ar kr", "in freq=440 rq=1", 1, stateful),
+	newUgenSpec("BPZ2", "ar kr", "in", 1, stateful),
+	newUgenSpec("BRF", "ar kr", "in freq=440 rq=1", 1, stateful),
+	newUgenSpec("BRZ2", "ar kr", "in", 1, stateful),
+	newUgenSpec("Decay", "ar kr", "in decayTime=1", 1, stateful),
+	newUgenSpec("Decay2", "ar kr", "in attackTime=0.01 decayTime=1", 1, stateful),
+	newUgenSpec("FOS", "ar kr", "in a0=0 a1=0 b1=0", 1, stateful),
+	newUgenSpec("Formlet", "ar kr", "in freq=440 attacktime=1 decaytime=1", 1, stateful),
+	newUgenSpec("HPF", "ar kr", "in freq=440", 1, stateful),
+	newUgenSpec("HPZ1", "ar kr", "in", 1, stateful),
+	newUgenSpec("HPZ2", "ar kr", "in", 1, stateful),
+	newUgenSpec("Integrator", "ar kr", "in coef=1", 1, stateful),
+	newUgenSpec("Lag", "ar kr", "in lagTime=0.1", 1, stateful),
+	newUgenSpec("Lag2", "ar kr", "in lagTime=0.1", 1, stateful),
+	newUgenSpec("Lag3", "ar kr", "in lagTime=0.1", 1, stateful),
+	newUgenSpec("LagUD", "ar kr", "in lagTimeU=0.1 lagTimeD=0.1", 1, stateful),
+	newUgenSpec("LeakDC", "ar kr", "in coef=0.995", 1, stateful),
+	newUgenSpec("LPF", "ar kr", "in freq=440", 1, stateful),
+	newUgenSpec("LPZ1", "ar kr", "in", 1, stateful),
+	newUgenSpec("LPZ2", "ar kr", "in", 1, stateful),
+	newUgenSpec("Median", "ar kr", "length=3 in", 1, stateful),
+	newUgenSpec("MidEQ", "ar kr", "in freq=440 rq=1 db=0", 1, stateful),
+	newUgenSpec("MoogFF", "ar kr", "in freq=100 gain=2 reset=0", 1, stateful),
+	newUgenSpec("OnePole", "ar kr", "in coef=0.5", 1, stateful),
+	newUgenSpec("OneZero", "ar kr", "in coef=0.5", 1, stateful),
+	newUgenSpec("Ramp", "ar kr", "in lagTime=0.1", 1, stateful),
+	newUgenSpec("Resonz", "ar kr", "in freq=440 bwr=1", 1, stateful),
+	newUgenSpec("RHPF", "ar kr", "in freq=440 rq=1", 1, stateful),
+	newUgenSpec("Ringz", "ar kr", "in freq=440 decaytime=1", 1, stateful),
+	newUgenSpec("RLPF", "ar kr", "in freq=440 rq=1", 1, stateful),
+	newUgenSpec("Slew", "ar kr", "in up=1 dn=1", 1, stateful),
+	newUgenSpec("Slope", "ar kr", "in", 1, stateful),
+	newUgenSpec("SOS", "ar kr", "in a0=0 a1=0 a2=0 b1=0 b2=0", 1, stateful),
+	newUgenSpec("TwoPole", "ar kr", "in freq=440 radius=0.8", 1, stateful),
+	newUgenSpec("TwoZero", "ar kr", "in freq=440 radius=0.8", 1, stateful),
+
+	// Dynamics, math, and conversion.
+	newUgenSpec("A2K", "kr", "in", 1, 0),
+	newUgenSpec("Amplitude", "ar kr", "in attackTime=0.01 releaseTime=0.01", 1, stateful),
+	newUgenSpec("Clip", "ir kr ar", "in lo=0 hi=1", 1, 0),
+	newUgenSpec("Compander", "ar", "in control thresh=0.5 slopeBelow=1 slopeAbove=1 clampTime=0.01 relaxTime=0.1", 1, stateful),
+	newUgenSpec("DC", "ar kr", "in", 1, 0),
+	newUgenSpec("Fold", "ir kr ar", "in lo=0 hi=1", 1, 0),
+	newUgenSpec("InRange", "ir kr ar", "in lo=0 hi=1", 1, 0),
+	newUgenSpec("K2A", "ar", "in", 1, stateful),
+	newUgenSpec("Limiter", "ar", "in level=1 dur=0.01", 1, stateful),
+	newUgenSpec("LinExp", "ir kr ar", "in srclo=0 srchi=1 dstlo=1 dsthi=2", 1, 0),
+	newUgenSpec("MantissaMask", "ar kr", "in bits=3", 1, 0),
+	newUgenSpec("Normalizer", "ar", "in level=1 dur=0.01", 1, stateful),
+	newUgenSpec("Pitch", "kr", "in initFreq=440 minFreq=60 maxFreq=4000 execFreq=100 maxBinsPerOctave=16 median=1 ampThreshold=0.01 peakThreshold=0.5 downSample=1 clar=0", 2, stateful),
+	newUgenSpec("Select", "ar kr", "which array...", 1, 0),
+	newUgenSpec("T2A", "ar", "in offset=0", 1, 0),
+	newUgenSpec("T2K", "kr", "in", 1, 0),
+	newUgenSpec("Wrap", "ir kr ar", "in lo=0 hi=1", 1, 0),
+
+	// Delays and reverbs.
+	newUgenSpec("AllpassC", "ar kr", "in maxdelaytime=0.2 delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("AllpassL", "ar kr", "in maxdelaytime=0.2 delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("AllpassN", "ar kr", "in maxdelaytime=0.2 delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("BufAllpassC", "ar", "buf in delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("BufAllpassL", "ar", "buf in delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("BufAllpassN", "ar", "buf in delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("BufCombC", "ar", "buf in delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("BufCombL", "ar", "buf in delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("BufCombN", "ar", "buf in delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("BufDelayC", "ar kr", "buf in delaytime=0.2", 1, stateful),
+	newUgenSpec("BufDelayL", "ar kr", "buf in delaytime=0.2", 1, stateful),
+	newUgenSpec("BufDelayN", "ar kr", "buf in delaytime=0.2", 1, stateful),
+	newUgenSpec("CombC", "ar kr", "in maxdelaytime=0.2 delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("CombL", "ar kr", "in maxdelaytime=0.2 delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("CombN", "ar kr", "in maxdelaytime=0.2 delaytime=0.2 decaytime=1", 1, stateful),
+	newUgenSpec("Delay1", "ar kr", "in", 1, stateful),
+	newUgenSpec("Delay2", "ar kr", "in", 1, stateful),
+	newUgenSpec("DelayC", "ar kr", "in maxdelaytime=0.2 delaytime=0.2", 1, stateful),
+	newUgenSpec("DelayL", "ar kr", "in maxdelaytime=0.2 delaytime=0.2", 1, stateful),
+	newUgenSpec("DelayN", "ar kr", "in maxdelaytime=0.2 delaytime=0.2", 1, stateful),
+	newUgenSpec("DelTapRd", "ar kr", "buffer phase delTime interp=1", 1, stateful),
+	newUgenSpec("DelTapWr", "ar kr", "buffer in", 1, stateful|sideEffects),
+	newUgenSpec("FreeVerb", "ar", "in mix=0.33 room=0.5 damp=0.5", 1, stateful),
+	newUgenSpec("FreeVerb2", "ar", "in in2 mix=0.33 room=0.5 damp=0.5", 2, stateful),
+	newUgenSpec("GVerb", "ar", "in roomsize=10 revtime=3 damping=0.5 inputbw=0.5 spread=15 drylevel=1 earlyreflevel=0.7 taillevel=0.5 maxroomsize=300", 2, stateful),
+	newUgenSpec("Pluck", "ar", "in trig=1 maxdelaytime=0.2 delaytime=0.2 decaytime=1 coef=0.5", 1, stateful),
+
+	// Panning.
+	newUgenSpec("Balance2", "ar kr", "left right pos=0 level=1", 2, stateful),
+	newUgenSpec("LinPan2", "ar kr", "in pos=0 level=1", 2, stateful),
+	newUgenSpec("LinXFade2", "ar kr", "inA inB=0 pan=0", 1, stateful),
+	newUgenSpec("Pan2", "ar kr", "in pos=0 level=1", 2, stateful),
+	newUgenSpec("Pan4", "ar kr", "in xpos=0 ypos=0 level=1", 4, stateful),
+	newUgenSpec("PanAz", "ar kr", "in pos=0 level=1 width=2 orientation=0.5", variableOutputs, stateful),
+	newUgenSpec("Rotate2", "ar kr", "x y pos=0", 2, stateful),
+	newUgenSpec("XFade2", "ar kr", "inA inB=0 pan=0 level=1", 1, stateful),
+
+	// Triggers.
+	newUgenSpec("Gate", "ar kr", "in trig=0", 1, stateful),
+	newUgenSpec("Latch", "ar kr", "in trig=0", 1, stateful),
+	newUgenSpec("Peak", "ar kr", "in trig=0", 1, stateful),
+	newUgenSpec("PeakFollower", "ar kr", "in decay=0.999", 1, stateful),
+	newUgenSpec("PulseCount", "ar kr", "trig=0 reset=0", 1, stateful),
+	newUgenSpec("PulseDivider", "ar kr", "trig=0 div=2 start=0", 1, stateful),
+	newUgenSpec("RunningMax", "ar kr", "in trig=0", 1, stateful),
+	newUgenSpec("RunningMin", "ar kr", "in trig=0", 1, stateful),
+	newUgenSpec("Schmidt", "ar kr", "in lo=0 hi=1", 1, stateful),
+	newUgenSpec("SetResetFF", "ar kr", "trig=0 reset=0", 1, stateful),
+	newUgenSpec("Stepper", "ar kr", "trig=0 reset=0 min=0 max=7 step=1 resetval", 1, stateful),
+	newUgenSpec("TDelay", "ar kr", "in dur=0.1", 1, stateful),
+	newUgenSpec("Timer", "ar kr", "trig=0", 1, stateful),
+	newUgenSpec("ToggleFF", "ar kr", "trig=0", 1, stateful),
+	newUgenSpec("Trig", "ar kr", "in dur=0.1", 1, stateful),
+	newUgenSpec("Trig1", "ar kr", "in dur=0.1", 1, stateful),
+	newUgenSpec("ZeroCrossing", "ar kr", "in", 1, stateful),
+
+	// Envelopes and node control.
+	newUgenSpec("DemandEnvGen", "ar kr", "level dur shape=1 curve=0 gate=1 reset=1 levelScale=1 levelBias=0 timeScale=1 doneAction=0", 1, stateful|sideEffects),
+	newUgenSpec("DetectSilence", "ar kr", "in amp=0.0001 time=0.1 doneAction=0", 1, stateful|sideEffects),
+	newUgenSpec("Done", "kr", "src", 1, 0),
+	newUgenSpec("EnvGen", "ar kr", "gate=1 levelScale=1 levelBias=0 timeScale=1 doneAction=0 envelope...", 1, stateful|sideEffects),
+	newUgenSpec("Free", "kr", "trig id", 1, sideEffects),
+	newUgenSpec("FreeSelf", "kr", "in", 1, sideEffects),
+	newUgenSpec("FreeSelfWhenDone", "kr", "src", 1, sideEffects),
+	newUgenSpec("IEnvGen", "ar kr", "index envelope...", 1, 0),
+	newUgenSpec("Line", "ar kr", "start=0 end=1 dur=1 doneAction=0", 1, stateful|sideEffects),
+	newUgenSpec("Linen", "kr", "gate=1 attackTime=0.01 susLevel=1 releaseTime=1 doneAction=0", 1, stateful|sideEffects),
+	newUgenSpec("Pause", "kr", "gate id", 1, sideEffects),
+	newUgenSpec("PauseSelf", "kr", "in", 1, sideEffects),
+	newUgenSpec("PauseSelfWhenDone", "kr", "src", 1, sideEffects),
+	newUgenSpec("XLine", "ar kr", "start=1 end=2 dur=1 doneAction=0", 1, stateful|sideEffects),
+
+	// Demand rate.
+	newUgenSpec("Dbrown", "dr", "length lo=0 hi=1 step=0.01", 1, stateful),
+	newUgenSpec("Dbufrd", "dr", "bufnum=0 phase=0 loop=1", 1, stateful),
+	newUgenSpec("Dbufwr", "dr", "bufnum=0 phase=0 input=0 loop=1", 1, stateful|sideEffects),
+	newUgenSpec("Demand", "ar kr", "trig reset demandUGens...", variableOutputs, stateful),
+	newUgenSpec("Dgeom", "dr", "length start=1 grow=2", 1, stateful),
+	newUgenSpec("Diwhite", "dr", "length lo=0 hi=1", 1, stateful),
+	newUgenSpec("Drand", "dr", "repeats=1 list...", 1, stateful),
+	newUgenSpec("Dseq", "dr", "repeats=1 list...", 1, stateful),
+	newUgenSpec("Dser", "dr", "repeats=1 list...", 1, stateful),
+	newUgenSpec("Dseries", "dr", "length start=1 step=1", 1, stateful),
+	newUgenSpec("Duty", "ar kr", "dur=1 reset=0 doneAction=0 level=1", 1, stateful|sideEffects),
+	newUgenSpec("Dwhite", "dr", "length lo=0 hi=1", 1, stateful),
+	newUgenSpec("Dxrand", "dr", "repeats=1 list...", 1, stateful),
+	newUgenSpec("TDuty", "ar kr", "dur=1 reset=0 doneAction=0 level=1 gapFirst=0", 1, stateful|sideEffects),
+
+	// Buses.
+	newUgenSpec("In", "ar kr", "bus=0", variableOutputs, 0),
+	newUgenSpec("InFeedback", "ar", "bus=0", variableOutputs, 0),
+	newUgenSpec("InTrig", "kr", "bus=0", variableOutputs, stateful),
+	newUgenSpec("LagIn", "kr", "bus=0 lag=0.1", variableOutputs, stateful),
+	newUgenSpec("LocalIn", "ar kr", "default...", variableOutputs, 0),
+	newUgenSpec("LocalOut", "ar kr", "channels...", 0, sideEffects),
+	newUgenSpec("OffsetOut", "ar kr", "bus channels...", 0, sideEffects),
+	newUgenSpec("Out", "ar kr", "bus channels...", 0, sideEffects),
+	newUgenSpec("ReplaceOut", "ar kr", "bus channels...", 0, sideEffects),
+	// sclang compiles SoundIn to In, but other tools can write it.
+	newUgenSpec("SoundIn", "ar", "bus=0", variableOutputs, 0),
+	newUgenSpec("XOut", "ar kr", "bus xfade channels...", 0, sideEffects),
+
+	// Buffers.
+	newUgenSpec("BufChannels", "ir kr", "bufnum", 1, 0),
+	newUgenSpec("BufDur", "ir kr", "bufnum", 1, 0),
+	newUgenSpec("BufFrames", "ir kr", "bufnum", 1, 0),
+	newUgenSpec("BufRateScale", "ir kr", "bufnum", 1, 0),
+	newUgenSpec("BufRd", "ar kr", "bufnum=0 phase=0 loop=1 interpolation=2", variableOutputs, 0),
+	newUgenSpec("BufSampleRate", "ir kr", "bufnum", 1, 0),
+	newUgenSpec("BufSamples", "ir kr", "bufnum", 1, 0),
+	newUgenSpec("BufWr", "ar kr", "bufnum=0 phase=0 loop=1 inputArray...", 1, sideEffects),
+	newUgenSpec("Convolution2", "ar", "in kernel trigger=0 framesize=2048", 1, stateful),
+	newUgenSpec("DetectIndex", "ar kr", "bufnum in=0", 1, stateful),
+	newUgenSpec("DiskIn", "ar", "bufnum loop=0", variableOutputs, stateful),
+	newUgenSpec("DiskOut", "ar", "bufnum channelsArray...", 1, sideEffects),
+	newUgenSpec("FFT", "kr", "buffer in=0 hop=0.5 wintype=0 active=1 winsize=0", 1, stateful|sideEffects),
+	newUgenSpec("FoldIndex", "ar kr", "bufnum in=0", 1, 0),
+	newUgenSpec("IFFT", "ar kr", "buffer wintype=0 winsize=0", 1, stateful),
+	newUgenSpec("Index", "ar kr", "bufnum in=0", 1, 0),
+	newUgenSpec("IndexInBetween", "ar kr", "bufnum in=0", 1, 0),
+	newUgenSpec("IndexL", "ar kr", "bufnum in=0", 1, 0),
+	newUgenSpec("LocalBuf", "ir", "numChannels=1 numFrames=1", 1, stateful),
+	newUgenSpec("MaxLocalBufs", "ir", "count", 1, sideEffects),
+	newUgenSpec("PartConv", "ar", "in fftsize irbufnum", 1, stateful),
+	newUgenSpec("PlayBuf", "ar kr", "bufnum=0 rate=1 trigger=1 startPos=0 loop=0 doneAction=0", variableOutputs, stateful|sideEffects),
+	newUgenSpec("PV_BrickWall", "kr", "buffer wipe=0", 1, sideEffects),
+	newUgenSpec("PV_Copy", "kr", "bufferA bufferB", 1, sideEffects),
+	newUgenSpec("PV_MagAbove", "kr", "buffer threshold=0", 1, sideEffects),
+	newUgenSpec("PV_MagFreeze", "kr", "buffer freeze=0", 1, stateful|sideEffects),
+	newUgenSpec("PV_RandComb", "kr", "buffer wipe=0 trig=0", 1, stateful|sideEffects),
+	newUgenSpec("RecordBuf", "ar kr", "bufnum=0 offset=0 recLevel=1 preLevel=0 run=1 loop=1 trigger=1 doneAction=0 inputArray...", 1, stateful|sideEffects),
+	newUgenSpec("Shaper", "ar kr", "bufnum in=0", 1, 0),
+	newUgenSpec("TGrains", "ar", "trigger=0 bufnum=0 rate=1 centerPos=0 dur=0.1 pan=0 amp=0.1 interp=4", variableOutputs, stateful),
+	newUgenSpec("VDiskIn", "ar", "bufnum rate=1 loop=0 sendID=0", variableOutputs, stateful|sideEffects),
+	newUgenSpec("WrapIndex", "ar kr", "bufnum in=0", 1, 0),
+
+	// Granular synthesis.
+	newUgenSpec("GrainBuf", "ar", "trigger=0 dur=1 sndbuf rate=1 pos=0 interp=2 pan=0 envbufnum=-1 maxGrains=512", variableOutputs, stateful),
+	newUgenSpec("GrainFM", "ar", "trigger=0 dur=1 carfreq=440 modfreq=200 index=1 pan=0 envbufnum=-1 maxGrains=512", variableOutputs, stateful),
+	newUgenSpec("GrainIn", "ar", "trigger=0 dur=1 in pan=0 envbufnum=-1 maxGrains=512", variableOutputs, stateful),
+	newUgenSpec("GrainSin", "ar", "trigger=0 dur=1 freq=440 pan=0 envbufnum=-1 maxGrains=512", variableOutputs, stateful),
+	newUgenSpec("Warp1", "ar", "bufnum=0 pointer=0 freqScale=1 windowSize=0.2 envbufnum=-1 overlaps=8 windowRandRatio=0 interp=1", variableOutputs, stateful),
+
+	// Server info.
+	newUgenSpec("BlockSize", "ir", "", 1, 0),
+	newUgenSpec("ControlDur", "ir", "", 1, 0),
+	newUgenSpec("ControlRate", "ir", "", 1, 0),
+	newUgenSpec("NumAudioBuses", "ir", "", 1, 0),
+	newUgenSpec("NumBuffers", "ir", "", 1, 0),
+	newUgenSpec("NumControlBuses", "ir", "", 1, 0),
+	newUgenSpec("NumInputBuses", "ir", "", 1, 0),
+	newUgenSpec("NumOutputBuses", "ir", "", 1, 0),
+	newUgenSpec("NumRunningSynths", "ir kr", "", 1, 0),
+	newUgenSpec("RadiansPerSample", "ir", "", 1, 0),
+	newUgenSpec("SampleDur", "ir", "", 1, 0),
+	newUgenSpec("SampleRate", "ir", "", 1, 0),
+	newUgenSpec("SubsampleOffset", "ir", "", 1, 0),
+
+	// User interface and messaging.
+	newUgenSpec("CheckBadValues", "ar kr", "in id=0 post=2", 1, sideEffects),
+	newUgenSpec("MouseButton", "kr", "minval=0 maxval=1 lag=0.2", 1, stateful),
+	newUgenSpec("MouseX", "kr", "minval=0 maxval=1 warp=0 lag=0.2", 1, stateful),
+	newUgenSpec("MouseY", "kr", "minval=0 maxval=1 warp=0 lag=0.2", 1, stateful),
+	newUgenSpec("Poll", "ar kr", "trig in trigid=-1 label...", 1, sideEffects),
+	newUgenSpec("SendReply", "ar kr", "trig=0 replyID=-1 cmdName...", 0, sideEffects),
+	newUgenSpec("SendTrig", "ar kr", "in=0 id=0 value=0", 0, sideEffects),
+}
+
+// coreUgenSince contains the first SuperCollider version of the core ugens that were added
+// during 3.x, for compat -version. Ugens that are not listed are in every 3.x version.
+var coreUgenSince = map[string]string{
+	"GrainBuf":     "3.3",
+	"GrainFM":      "3.3",
+	"GrainIn":      "3.3",
+	"GrainSin":     "3.3",
+	"LFGauss":      "3.4",
+	"LocalBuf":     "3.4",
+	"MaxLocalBufs": "3.4",
+	"PartConv":     "3.3",
+	"Warp1":        "3.3",
+}
+
+// coreUgenPlugins contains the plugin libraries that ship with scsynth and the core ugens each defines.
+var coreUgenPlugins = map[string][]string{
+	"BinaryOpUGens": {"BinaryOpUGen"},
+	"DelayUGens": {
+		"AllpassC", "AllpassL", "AllpassN", "BufAllpassC", "BufAllpassL", "BufAllpassN",
+		"BufChannels", "BufCombC", "BufCombL", "BufCombN", "BufDelayC", "BufDelayL", "BufDelayN",
+		"BufDur", "BufFrames", "BufRateScale", "BufRd", "BufSampleRate", "BufSamples", "BufWr",
+		"CombC", "CombL", "CombN", "Delay1", "Delay2", "DelayC", "DelayL", "DelayN", "DelTapRd", "DelTapWr",
+		"LocalBuf", "MaxLocalBufs", "Pitch", "PlayBuf", "Pluck", "RecordBuf", "TGrains",
+		"BlockSize", "ControlDur", "ControlRate", "NumAudioBuses", "NumBuffers", "NumControlBuses",
+		"NumInputBuses", "NumOutputBuses", "NumRunningSynths", "RadiansPerSample", "SampleDur",
+		"SampleRate", "SubsampleOffset",
+	},
+	"DemandUGens": {
+		"Dbrown", "Dbufrd", "Dbufwr", "Demand", "DemandEnvGen", "Dgeom", "Diwhite", "Drand",
+		"Dseq", "Dser", "Dseries", "Duty", "Dwhite", "Dxrand", "TDuty",
+	},
+	"DiskIO_UGens":  {"DiskIn", "DiskOut", "VDiskIn"},
+	"DynNoiseUGens": {"LFDNoise0", "LFDNoise1", "LFDNoise3"},
+	"FFT_UGens": {
+		"Convolution2", "FFT", "IFFT", "PartConv",
+		"PV_BrickWall", "PV_Copy", "PV_MagAbove", "PV_MagFreeze", "PV_RandComb",
+	},
+	"FilterUGens": {
+		"Amplitude", "BAllPass", "BBandPass", "BBandStop", "BHiPass", "BHiShelf", "BLowPass",
+		"BLowShelf", "BPeakEQ", "BPF", "BPZ2", "BRF", "BRZ2", "Compander", "Decay", "Decay2",
+		"DetectSilence", "FOS", "Formlet", "HPF", "HPZ1", "HPZ2", "Integrator", "Lag", "Lag2",
+		"Lag3", "LagUD", "LeakDC", "Limiter", "LPF", "LPZ1", "LPZ2", "Median", "MidEQ", "MoogFF",
+		"Normalizer", "OnePole", "OneZero", "Ramp", "Resonz", "RHPF", "Ringz", "RLPF", "Slew",
+		"Slope", "SOS", "TwoPole", "TwoZero",
+	},
+	"GrainUGens": {"GrainBuf", "GrainFM", "GrainIn", "GrainSin", "Warp1"},
+	"IOUGens": {
+		"AudioControl", "Control", "LagControl", "TrigControl",
+		"In", "InFeedback", "InTrig", "LagIn", "LocalIn", "LocalOut", "OffsetOut", "Out",
+		"ReplaceOut", "SoundIn", "XOut",
+	},
+	"LFUGens": {
+		"A2K", "Clip", "DC", "EnvGen", "Fold", "IEnvGen", "Impulse", "InRange", "K2A", "LFCub",
+		"LFGauss", "LFPar", "LFPulse", "LFSaw", "LFTri", "Line", "Linen", "LinExp", "SyncSaw",
+		"T2A", "T2K", "VarSaw", "Wrap", "XLine",
+	},
+	"MulAddUGens": {"MulAdd", "Sum3", "Sum4"},
+	"NoiseUGens": {
+		"BrownNoise", "ClipNoise", "CoinGate", "Crackle", "Dust", "Dust2", "ExpRand", "GrayNoise",
+		"Hasher", "IRand", "LFClipNoise", "LFNoise0", "LFNoise1", "LFNoise2", "LinRand",
+		"MantissaMask", "NRand", "PinkNoise", "Rand", "RandID", "RandSeed", "TExpRand", "TIRand",
+		"TRand", "WhiteNoise",
+	},
+	"OscUGens": {
+		"Blip", "COsc", "DetectIndex", "FoldIndex", "Formant", "FSinOsc", "Index", "IndexInBetween",
+		"IndexL", "Klang", "Klank", "Osc", "OscN", "Pulse", "Saw", "Select", "Shaper", "SinOsc",
+		"VOsc", "VOsc3", "WrapIndex",
+	},
+	"PanUGens":    {"Balance2", "LinPan2", "LinXFade2", "Pan2", "Pan4", "PanAz", "Rotate2", "XFade2"},
+	"ReverbUGens": {"FreeVerb", "FreeVerb2", "GVerb"},
+	"TestUGens":   {"CheckBadValues"},
+	"TriggerUGens": {
+		"Done", "Free", "FreeSelf", "FreeSelfWhenDone", "Gate", "Latch", "Pause", "PauseSelf",
+		"PauseSelfWhenDone", "Peak", "PeakFollower", "Phasor", "Poll", "PulseCount", "PulseDivider",
+		"RunningMax", "RunningMin", "Schmidt", "SendReply", "SendTrig", "SetResetFF", "Stepper",
+		"Sweep", "TDelay", "Timer", "ToggleFF", "Trig", "Trig1", "ZeroCrossing",
+	},
+	"UIUGens":      {"MouseButton", "MouseX", "MouseY"},
+	"UnaryOpUGens": {"UnaryOpUGen"},
+}
+
+// binaryOperators contains the names of the BinaryOpUGen operators by special index.
+var binaryOperators = []string{
+	"+", "-", "*", "div", "/", "mod", "==", "!=", "<", ">", "<=", ">=", "min", "max",
+	"bitAnd", "bitOr", "bitXor", "lcm", "gcd", "round", "roundUp", "trunc", "atan2",
+	"hypot", "hypotApx", "pow", "leftShift", "rightShift", "unsignedRightShift", "fill",
+	"ring1", "ring2", "ring3", "ring4", "difsqr", "sumsqr", "sqrsum", "sqrdif", "absdif",
+	"thresh", "amclip", "scaleneg", "clip2", "excess", "fold2", "wrap2", "firstArg",
+	"rrand", "exprand",
+}
+
+// unaryOperators contains the names of the UnaryOpUGen operators by special index.
+var unaryOperators = []string{
+	"neg", "not", "isNil", "notNil", "bitNot", "abs", "asFloat", "asInt", "ceil", "floor",
+	"frac", "sign", "squared", "cubed", "sqrt", "exp", "reciprocal", "midicps", "cpsmidi",
+	"midiratio", "ratiomidi", "dbamp", "ampdb", "octcps", "cpsoct", "log", "log2", "log10",
+	"sin", "cos", "tan", "asin", "acos", "atan", "sinh", "cosh", "tanh", "rand", "rand2",
+	"linrand", "bilinrand", "sum3rand", "distort", "softclip", "coin", "digitvalue",
+	"silence", "thru", "rectWindow", "hanWindow", "welchWindow", "triWindow", "ramp", "scurve",
+}
+
+// operatorName returns the name of the operator of a BinaryOpUGen or UnaryOpUGen,
+// or the empty string for any other ugen.
+func operatorName(u *sc.Ugen) string {
+	var ops []string
+	switch u.Name {
+	case "BinaryOpUGen":
+		ops = binaryOperators
+	case "UnaryOpUGen":
+		ops = unaryOperators
+	default:
+		return ""
+	}
+	if u.SpecialIndex < 0 || int(u.SpecialIndex) >= len(ops) {
+		return fmt.Sprintf("op(%d)", u.SpecialIndex)
+	}
+	return ops[u.SpecialIndex]
+}
+
+// rateMethod returns the sclang method name of a calculation rate, e.g. "kr".
+func rateMethod(rate int8) string {
+	switch rate {
+	case sc.IR:
+		return "ir"
+	case sc.KR:
+		return "kr"
+	case sc.AR:
+		return "ar"
+	case rateDemand:
+		return "dr"
+	}
+	return fmt.Sprintf("rate(%d)", rate)
+}
+
+// ugenCatalog maps ugen names to their specs.
+type ugenCatalog map[string]ugenSpec
+
+// newUgenCatalog creates a catalog that contains the core ugens.
+func newUgenCatalog() ugenCatalog {
+	cat := ugenCatalog{}
+	for _, spec := range coreUgens {
+		spec.Since = coreUgenSince[spec.Name]
+		cat[spec.Name] = spec
+	}
+	for plugin, names := range coreUgenPlugins {
+		for _, name := range names {
+			if spec, ok := cat[name]; ok {
+				spec.Plugin = plugin
+				cat[name] = spec
+			}
+		}
+	}
+	return cat
+}
+
+// load adds the ugens of a JSON file to the catalog.
+// The file must contain an array of ugen specs. Specs replace
+// any spec in the catalog that has the same name.
+func (cat ugenCatalog) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening ugen catalog")
+	}
+	defer func() { _ = f.Close() }()
+
+	specs := []ugenSpec{}
+	if err := json.NewDecoder(f).Decode(&specs); err != nil {
+		return errors.Wrap(err, "decoding ugen catalog "+path)
+	}
+	for _, spec := range specs {
+		if spec.Name == "" {
+			return errors.Errorf("ugen with no name in %s", path)
+		}
+		if spec.Inputs == nil {
+			spec.Inputs = []inputSpec{}
+		}
+		cat[spec.Name] = spec
+	}
+	return nil
+}
+
+// specs returns the specs in the catalog sorted by name.
+func (cat ugenCatalog) specs() []ugenSpec {
+	specs := make([]ugenSpec, 0, len(cat))
+	for _, spec := range cat {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+// inputName returns the name of a ugen input, e.g. "freq".
+// Repeated variadic inputs get their offset appended, e.g. "channels[1]".
+// The name is "input N" if the ugen is not in the catalog.
+func (cat ugenCatalog) inputName(u *sc.Ugen, idx int) string {
+	spec, ok := cat[u.Name]
+	if !ok || len(spec.Inputs) == 0 {
+		return fmt.Sprintf("input %d", idx)
+	}
+	last := len(spec.Inputs) - 1
+	if idx < last || (idx == last && !spec.Variadic) {
+		return spec.Inputs[idx].Name
+	}
+	if !spec.Variadic {
+		return fmt.Sprintf("input %d", idx)
+	}
+	return fmt.Sprintf("%s[%d]", spec.Inputs[last].Name, idx-last)
+}
+
+// inputLabel returns the name of a ugen input qualified with the ugen name, e.g. "SinOsc.freq".
+func (cat ugenCatalog) inputLabel(u *sc.Ugen, idx int) string {
+	if _, ok := cat[u.Name]; !ok {
+		return fmt.Sprintf("%s input %d", u.Name, idx)
+	}
+	return u.Name + "." + cat.inputName(u, idx)
+}
+
+// check returns a description of every way a ugen does not match its spec.
+// Ugens that are not in the catalog are not checked.
+func (cat ugenCatalog) check(u *sc.Ugen) []string {
+	spec, ok := cat[u.Name]
+	if !ok {
+		return nil
+	}
+	problems := []string{}
+
+	if spec.Variadic {
+		if min := len(spec.Inputs) - 1; len(u.Inputs) < min {
+			problems = append(problems, fmt.Sprintf("has %d inputs, expected at least %d", len(u.Inputs), min))
+		}
+	} else if len(u.Inputs) != len(spec.Inputs) {
+		problems = append(problems, fmt.Sprintf("has %d inputs, expected %d", len(u.Inputs), len(spec.Inputs)))
+	}
+	if spec.Outputs != variableOutputs && len(u.Outputs) != spec.Outputs {
+		problems = append(problems, fmt.Sprintf("has %d outputs, expected %d", len(u.Outputs), spec.Outputs))
+	}
+	if rate := rateMethod(u.Rate); len(spec.Rates) > 0 && !containsString(spec.Rates, rate) {
+		problems = append(problems, fmt.Sprintf("runs at %s, expected one of %s", rate, strings.Join(spec.Rates, ", ")))
+	}
+	return problems
+}
+
+// checkSynthdef checks every ugen of a synthdef against the catalog.
+func (cat ugenCatalog) checkSynthdef(def *sc.Synthdef) []string {
+	problems := []string{}
+	for i, u := range def.Ugens {
+		for _, problem := range cat.check(u) {
+			problems = append(problems, fmt.Sprintf("%s(%d) %s", u.Name, i, problem))
+		}
+	}
+	return problems
+}
+
+// containsString returns true if ss contains s.
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCatalog creates the ugen catalog for a command, extended with the
+// files passed with -catalog.
+func (c *controller) loadCatalog() (ugenCatalog, error) {
+	cat := newUgenCatalog()
+	for _, path := range c.catalogFiles {
+		if err := cat.load(path); err != nil {
+			return nil, err
+		}
+	}
+	return cat, nil
+}
+
+// catalog runs the catalog command
+func (c *controller) catalog() error {
+	fset := c.flagSets["catalog"]
+
+	cat, err := c.loadCatalog()
+	if err != nil {
+		return err
+	}
+	specs := cat.specs()
+	if fset.NArg() > 0 {
+		specs = specs[:0]
+		for _, name := range fset.Args() {
+			spec, ok := cat[name]
+			if !ok {
+				return errors.Errorf("no ugen named %s in the catalog", name)
+			}
+			specs = append(specs, spec)
+		}
+	}
+	switch *c.catalogOutput {
+	case "json":
+		return writeJSON(os.Stdout, specs)
+	case "text":
+		return writeCatalog(os.Stdout, specs)
+	default:
+		return errors.Errorf("unsupported output format %q", *c.catalogOutput)
+	}
+}
+
+// writeCatalog writes one line per ugen spec with its rates, inputs, and outputs.
+func writeCatalog(w io.Writer, specs []ugenSpec) error {
+	for _, spec := range specs {
+		inputs := make([]string, len(spec.Inputs))
+		for i, is := range spec.Inputs {
+			inputs[i] = is.Name
+			if is.Default != nil {
+				inputs[i] += fmt.Sprintf("=%g", *is.Default)
+			}
+		}
+		if spec.Variadic && len(inputs) > 0 {
+			inputs[len(inputs)-1] += "..."
+		}
+		outputs := strconv.Itoa(spec.Outputs)
+		if spec.Outputs == variableOutputs {
+			outputs = "N"
+		}
+		line := fmt.Sprintf("%-18s %-12s (%s) -> %s", spec.Name, strings.Join(spec.Rates, ","), strings.Join(inputs, " "), outputs)
+		if spec.Stateful {
+			line += "  stateful"
+		}
+		if spec.SideEffects {
+			line += "  side-effects"
+		}
+		if spec.Plugin != "" {
+			line += "  plugin " + spec.Plugin
+		}
+		if spec.Since != "" {
+			line += "  since " + spec.Since
+		}
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// synthdefV2Since is the first SuperCollider version that reads version 2 synthdef files.
+// Version 2 widened the counts and indices of version 1 from int16 to int32.
+const synthdefV2Since = "3.4"
+
+// pluginExts are the file extensions of scsynth plugin libraries.
+var pluginExts = map[string]struct{}{
+	".scx": struct{}{},
+	".so":  struct{}{},
+}
+
+// compatProfile describes a target scsynth installation.
+type compatProfile struct {
+	// Version is the SuperCollider version, e.g. "3.6.6".
+	// Version checks are skipped if it is empty.
+	Version string `json:"version"`
+
+	// Plugins are the names of the installed plugin libraries, e.g. "MdaUGens".
+	// The ugens of a plugin library are found with the plugin field of the ugen catalog.
+	Plugins []string `json:"plugins"`
+
+	// Complete is true if Plugins lists every installed library, including the ones that
+	// ship with scsynth, as a plugin directory listing does. Then core ugens need their
+	// library too, and ugens that neither the catalog nor the profile knows about are missing.
+	Complete bool `json:"complete"`
+
+	// Ugens are the names of installed ugens that the catalog does not know about.
+	Ugens []string `json:"ugens"`
+
+	// MaxParams is the maximum number of params the target supports, or 0 for no limit.
+	MaxParams int `json:"maxParams"`
+}
+
+// readCompatProfile reads a target profile from a JSON file.
+func readCompatProfile(path string) (*compatProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	profile := &compatProfile{}
+	if err := json.NewDecoder(f).Decode(profile); err != nil {
+		return nil, errors.Wrap(err, "decoding "+path)
+	}
+	return profile, nil
+}
+
+// addPluginDir adds every plugin library found in a directory and its subdirectories to the profile,
+// which is then taken to be complete.
+func (p *compatProfile) addPluginDir(dir string) error {
+	p.Complete = true
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if _, ok := pluginExts[ext]; ok {
+			p.Plugins = append(p.Plugins, strings.TrimSuffix(filepath.Base(path), ext))
+		}
+		return nil
+	})
+}
+
+// knowsUgen returns true if the profile or the catalog has a ugen, so that hasUgen can check it.
+func (p *compatProfile) knowsUgen(cat ugenCatalog, name string) bool {
+	_, ok := cat[name]
+	return ok || containsString(p.Ugens, name)
+}
+
+// hasUgen returns true if the target has a ugen that knowsUgen knows about.
+// Ugens are available if the target version is at least the version that introduced them,
+// and their plugin library is installed. The libraries that ship with scsynth are only
+// checked if the profile is complete.
+func (p *compatProfile) hasUgen(cat ugenCatalog, name string) bool {
+	if containsString(p.Ugens, name) {
+		return true
+	}
+	spec := cat[name]
+	if spec.Plugin != "" && !containsString(p.Plugins, spec.Plugin) {
+		if _, core := coreUgenPlugins[spec.Plugin]; !core || p.Complete {
+			return false
+		}
+	}
+	return p.Version == "" || spec.Since == "" || compareVersions(p.Version, spec.Since) >= 0
+}
+
+// compareVersions compares two dotted version strings numerically,
+// returning -1, 0, or 1. Missing components count as zero, so "3.6" == "3.6.0".
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+// missingUgen is a ugen that a synthdef uses and the target lacks.
+type missingUgen struct {
+	Ugen   string `json:"ugen"`
+	Plugin string `json:"plugin,omitempty"`
+	Since  string `json:"since,omitempty"`
+	Uses   []int  `json:"uses"`
+
+	// Unknown is true if neither the catalog nor the complete profile knows about the ugen.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// String returns a short description of the missing ugen.
+func (mu missingUgen) String() string {
+	s := "missing ugen " + mu.Ugen
+	switch {
+	case mu.Unknown:
+		s += " (not in the catalog or any installed plugin)"
+	case mu.Plugin != "":
+		s += " (plugin " + mu.Plugin + ")"
+	case mu.Since != "":
+		s += " (since " + mu.Since + ")"
+	}
+	return s + fmt.Sprintf(", used %d time(s)", len(mu.Uses))
+}
+
+// compatReport is the compatibility report for a single synthdef file.
+type compatReport struct {
+	File        string        `json:"file"`
+	Synthdef    string        `json:"synthdef"`
+	Missing     []missingUgen `json:"missing"`
+	Unsupported []string      `json:"unsupported"`
+
+	// Unknown are the ugens that neither the catalog nor an incomplete profile knows about.
+	// They cannot be checked, so they are not counted as problems.
+	Unknown []string `json:"unknown"`
+}
+
+// problems returns the number of problems in the report.
+func (r compatReport) problems() int {
+	return len(r.Missing) + len(r.Unsupported)
+}
+
+// checkCompat checks a synthdef file against a target profile.
+func checkCompat(entry libraryEntry, profile *compatProfile, cat ugenCatalog) compatReport {
+	var (
+		def    = entry.Def
+		report = compatReport{File: entry.Path, Synthdef: def.Name, Missing: []missingUgen{}, Unsupported: []string{}, Unknown: []string{}}
+		byName = map[string]*missingUgen{}
+	)
+	for i, u := range def.Ugens {
+		known := profile.knowsUgen(cat, u.Name)
+		if !known && !profile.Complete {
+			if !containsString(report.Unknown, u.Name) {
+				report.Unknown = append(report.Unknown, u.Name)
+			}
+			continue
+		}
+		if known && profile.hasUgen(cat, u.Name) {
+			continue
+		}
+		mu, ok := byName[u.Name]
+		if !ok {
+			spec := cat[u.Name]
+			mu = &missingUgen{Ugen: u.Name, Plugin: spec.Plugin, Since: spec.Since, Unknown: !known}
+			byName[u.Name] = mu
+		}
+		mu.Uses = append(mu.Uses, i)
+	}
+	for _, mu := range byName {
+		report.Missing = append(report.Missing, *mu)
+	}
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i].Ugen < report.Missing[j].Ugen })
+	sort.Strings(report.Unknown)
+
+	// The sc package only reads and writes version 2 files.
+	if profile.Version != "" && compareVersions(profile.Version, synthdefV2Since) < 0 {
+		report.Unsupported = append(report.Unsupported, fmt.Sprintf("synthdef file format version 2 needs SuperCollider %s or later, target is %s", synthdefV2Since, profile.Version))
+	}
+	if n := len(def.InitialParamValues); profile.MaxParams > 0 && n > profile.MaxParams {
+		report.Unsupported = append(report.Unsupported, fmt.Sprintf("%d params, target supports at most %d", n, profile.MaxParams))
+	}
+	return report
+}
+
+// compat runs the compat command
+func (c *controller) compat() error {
+	fset := c.flagSets["compat"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file")
+	}
+	if *c.compatProfile == "" && len(c.compatPlugins) == 0 {
+		return errors.New("expected -profile or -plugins")
+	}
+	cat, err := c.loadCatalog()
+	if err != nil {
+		return err
+	}
+	profile := &compatProfile{}
+	if *c.compatProfile != "" {
+		if profile, err = readCompatProfile(*c.compatProfile); err != nil {
+			return err
+		}
+	}
+	for _, dir := range c.compatPlugins {
+		if err := profile.addPluginDir(dir); err != nil {
+			return errors.Wrap(err, "reading plugin directory")
+		}
+	}
+	if *c.compatVersion != "" {
+		profile.Version = *c.compatVersion
+	}
+	var (
+		reports  = []compatReport{}
+		problems = 0
+	)
+	for _, path := range fset.Args() {
+		def, err := readSynthdefFile(path)
+		if err != nil {
+			return err
+		}
+		report := checkCompat(libraryEntry{Path: path, Def: def}, profile, cat)
+		problems += report.problems()
+		reports = append(reports, report)
+	}
+	switch *c.compatOutput {
+	case "json":
+		err = writeJSON(os.Stdout, reports)
+	case "text":
+		err = writeCompat(os.Stdout, reports)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.compatOutput)
+	}
+	if err != nil {
+		return err
+	}
+	if problems > 0 {
+		return errors.Errorf("found %d compatibility problem(s)", problems)
+	}
+	return nil
+}
+
+// writeCompat writes a human-readable compatibility report.
+func writeCompat(w io.Writer, reports []compatReport) error {
+	for _, report := range reports {
+		if report.problems() == 0 {
+			fmt.Fprintf(w, "%s (%s): ok\n", report.File, report.Synthdef)
+		} else {
+			fmt.Fprintf(w, "%s (%s): %d problem(s)\n", report.File, report.Synthdef, report.problems())
+		}
+		for _, mu := range report.Missing {
+			fmt.Fprintf(w, "  %s\n", mu)
+		}
+		for _, unsupported := range report.Unsupported {
+			fmt.Fprintf(w, "  %s\n", unsupported)
+		}
+		for _, name := range report.Unknown {
+			fmt.Fprintf(w, "  unknown ugen %s, cannot check\n", name)
+		}
+	}
+	return nil
+}
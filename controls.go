@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/xml"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// paramControl maps a single param index to the control ugen output that carries it.
+// Arrayed params span several consecutive indices, and each index gets its own paramControl.
+type paramControl struct {
+	Index       int32   `json:"index"       xml:"index,attr"`
+	Name        string  `json:"name"        xml:"name,attr"`
+	Offset      int32   `json:"offset"      xml:"offset,attr"`
+	Length      int32   `json:"length"      xml:"length,attr"`
+	Default     float32 `json:"default"     xml:"default,attr"`
+	Control     string  `json:"control"     xml:"control,attr"`
+	UgenIndex   int32   `json:"ugenIndex"   xml:"ugenIndex,attr"`
+	OutputIndex int32   `json:"outputIndex" xml:"outputIndex,attr"`
+	Rate        string  `json:"rate"        xml:"rate,attr"`
+	Lag         float32 `json:"lag,omitempty" xml:"lag,attr,omitempty"`
+}
+
+// controlModel maps every param index of a synthdef to its control ugen,
+// rate, lag, and array slice.
+// A synthdef can contain any number of Control, TrigControl, AudioControl,
+// and LagControl ugens. The special index of each one is the index of the
+// first param it outputs.
+type controlModel struct {
+	Params []paramControl
+}
+
+// newControlModel creates the control model of a synthdef.
+func newControlModel(def *sc.Synthdef) *controlModel {
+	m := &controlModel{}
+
+	for ui, u := range def.Ugens {
+		if _, ok := controlNames[u.Name]; !ok {
+			continue
+		}
+		for oi := range u.Outputs {
+			idx := int32(u.SpecialIndex) + int32(oi)
+			pc := paramControl{
+				Index:       idx,
+				Control:     u.Name,
+				UgenIndex:   int32(ui),
+				OutputIndex: int32(oi),
+				Rate:        rateName(u.Rate),
+			}
+			if idx >= 0 && int(idx) < len(def.InitialParamValues) {
+				pc.Default = def.InitialParamValues[idx]
+			}
+			// LagControl has one lag time input per output.
+			if u.Name == "LagControl" && oi < len(u.Inputs) && u.Inputs[oi].IsConstant() {
+				pc.Lag = def.Constants[u.Inputs[oi].OutputIndex]
+			}
+			m.Params = append(m.Params, pc)
+		}
+	}
+	sort.Slice(m.Params, func(i, j int) bool { return m.Params[i].Index < m.Params[j].Index })
+
+	for _, slice := range paramSlices(def) {
+		for i := range m.Params {
+			pc := &m.Params[i]
+			if pc.Index >= slice.Index && pc.Index < slice.Index+slice.Length {
+				pc.Name = slice.Name
+				pc.Offset = pc.Index - slice.Index
+				pc.Length = slice.Length
+			}
+		}
+	}
+	return m
+}
+
+// lookup returns the param carried by an output of a control ugen.
+func (m *controlModel) lookup(ugenIndex, outputIndex int32) (paramControl, bool) {
+	for _, pc := range m.Params {
+		if pc.UgenIndex == ugenIndex && pc.OutputIndex == outputIndex {
+			return pc, true
+		}
+	}
+	return paramControl{}, false
+}
+
+// control returns the param control at a param index.
+func (m *controlModel) control(idx int32) (paramControl, bool) {
+	for _, pc := range m.Params {
+		if pc.Index == idx {
+			return pc, true
+		}
+	}
+	return paramControl{}, false
+}
+
+// paramSlice is the range of param indices covered by one param name.
+type paramSlice struct {
+	Name   string
+	Index  int32
+	Length int32
+}
+
+// paramSlices returns the param names of a synthdef ordered by index.
+// The length of each param is implied by the gap to the index of the next param,
+// so the length of arrayed params is greater than one.
+func paramSlices(def *sc.Synthdef) []paramSlice {
+	names := make([]sc.ParamName, len(def.ParamNames))
+	copy(names, def.ParamNames)
+	sort.Slice(names, func(i, j int) bool { return names[i].Index < names[j].Index })
+
+	slices := make([]paramSlice, len(names))
+	for i, pn := range names {
+		end := int32(len(def.InitialParamValues))
+		if i+1 < len(names) {
+			end = names[i+1].Index
+		}
+		slices[i] = paramSlice{Name: pn.Name, Index: pn.Index, Length: end - pn.Index}
+	}
+	return slices
+}
+
+// hasParam returns true if a synthdef has a param with the provided name.
+func hasParam(def *sc.Synthdef, name string) bool {
+	for _, slice := range paramSlices(def) {
+		if slice.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkParams returns an error that lists the valid param names of a synthdef
+// if any of the provided names is not one of them.
+func checkParams(def *sc.Synthdef, params map[string]float32) error {
+	unknown := []string{}
+	for name := range params {
+		if !hasParam(def, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	valid := []string{}
+	for _, slice := range paramSlices(def) {
+		valid = append(valid, slice.Name)
+	}
+	sort.Strings(unknown)
+	return errors.Errorf("%s has no param(s) %s, valid params are %s", def.Name, strings.Join(unknown, ", "), strings.Join(valid, ", "))
+}
+
+// formattedSynthdef is a synthdef along with its control model and the
+// input names from the ugen catalog, as written by the json and xml
+// outputs of the format command.
+type formattedSynthdef struct {
+	XMLName xml.Name `json:"-" xml:"Synthdef"`
+	*sc.Synthdef
+	Ugens    []formattedUgen `json:"ugens,omitempty" xml:"Ugens>Ugen"`
+	Controls []paramControl  `json:"controls,omitempty" xml:"Controls>Control"`
+	Warnings []string        `json:"warnings,omitempty" xml:"Warnings>Warning"`
+}
+
+// formattedUgen is a ugen along with the names of its inputs and its operator.
+type formattedUgen struct {
+	*sc.Ugen
+	Operator   string   `json:"operator,omitempty" xml:"operator,attr,omitempty"`
+	InputNames []string `json:"inputNames,omitempty" xml:"InputNames>InputName"`
+}
+
+// newFormattedSynthdef creates a formattedSynthdef.
+func newFormattedSynthdef(def *sc.Synthdef, cat ugenCatalog) formattedSynthdef {
+	fd := formattedSynthdef{
+		Synthdef: def,
+		Ugens:    make([]formattedUgen, len(def.Ugens)),
+		Controls: newControlModel(def).Params,
+		Warnings: cat.checkSynthdef(def),
+	}
+	for i, u := range def.Ugens {
+		fd.Ugens[i] = formattedUgen{Ugen: u, Operator: operatorName(u)}
+		for ii := range u.Inputs {
+			fd.Ugens[i].InputNames = append(fd.Ugens[i].InputNames, cat.inputName(u, ii))
+		}
+	}
+	return fd
+}
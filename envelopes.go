@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// envNodeNone is the value of a decoded release or loop node when the envelope has none.
+const envNodeNone = -1
+
+// Size of the ASCII and SVG envelope plots.
+const (
+	envPlotColumns = 64
+	envPlotRows    = 12
+	envPlotWidth   = 480
+	envPlotHeight  = 120
+	envPlotMargin  = 24
+)
+
+// envShapeNames contains the names of the envelope shapes by shape number.
+// These are the names in the shapeNames table of the sc package, which is not exported.
+var envShapeNames = []string{"step", "linear", "exponential", "sine", "welch", "curve", "squared", "cubed", "hold"}
+
+// envShapeName returns the name of an envelope shape number.
+func envShapeName(shape int) string {
+	if shape < 0 || shape >= len(envShapeNames) {
+		return fmt.Sprintf("shape(%d)", shape)
+	}
+	return envShapeNames[shape]
+}
+
+// envSegment is a segment of an envelope that goes to a level over a time.
+// Curve is only relevant to the "curve" shape.
+type envSegment struct {
+	Level inputSource  `json:"level"`
+	Time  inputSource  `json:"time"`
+	Shape string       `json:"shape"`
+	Curve *inputSource `json:"curve,omitempty"`
+}
+
+// decodedEnvelope is the envelope of an EnvGen or IEnvGen.
+type decodedEnvelope struct {
+	Ugen        string       `json:"ugen"`
+	UgenIndex   int          `json:"ugenIndex"`
+	Start       inputSource  `json:"start"`
+	Segments    []envSegment `json:"segments"`
+	ReleaseNode int          `json:"releaseNode"`
+	LoopNode    int          `json:"loopNode"`
+	Offset      *inputSource `json:"offset,omitempty"`
+	Duration    float64      `json:"duration"`
+	Warnings    []string     `json:"warnings,omitempty"`
+
+	shapes []int
+}
+
+// envInputOffsets maps the names of the ugens that have an envelope to the index of its first input.
+var envInputOffsets = map[string]int{
+	"EnvGen":  5,
+	"IEnvGen": 1,
+}
+
+// decodeEnvelope decodes the envelope of an EnvGen or IEnvGen.
+// EnvGen envelopes are laid out like sc.Env.Inputs: start level, segment count, release node, loop node,
+// then a level, time, shape, and curve for each segment. IEnvGen envelopes are laid out for interpolation:
+// offset, start level, segment count, total duration, then a time, shape, curve, and level for each segment.
+// The number of segments and the shapes must be constants; everything else may come from params.
+func decodeEnvelope(def *sc.Synthdef, idx int, overrides map[string]float32) (decodedEnvelope, error) {
+	var (
+		u     = def.Ugens[idx]
+		first = envInputOffsets[u.Name]
+		env   = decodedEnvelope{Ugen: u.Name, UgenIndex: idx, Segments: []envSegment{}, ReleaseNode: envNodeNone, LoopNode: envNodeNone}
+	)
+	if len(u.Inputs) < first+4 {
+		return env, errors.Errorf("%s(%d) has no envelope", u.Name, idx)
+	}
+	in := func(i int) inputSource { return describeInput(def, u.Inputs[first+i]) }
+	constant := func(i int, what string) (int, error) {
+		src := in(i)
+		if src.Kind != sourceConstant {
+			return 0, errors.Errorf("%s(%d) has its %s %s", u.Name, idx, what, describeSource(src))
+		}
+		return int(src.Value), nil
+	}
+	var (
+		numSegments int
+		err         error
+	)
+	if u.Name == "IEnvGen" {
+		offset := in(0)
+		env.Offset = &offset
+		env.Start = in(1)
+		numSegments, err = constant(2, "segment count")
+	} else {
+		env.Start = in(0)
+		numSegments, err = constant(1, "segment count")
+	}
+	if err != nil {
+		return env, err
+	}
+	if need := 4 + 4*numSegments; len(u.Inputs)-first < need {
+		return env, errors.Errorf("%s(%d) has %d envelope inputs, expected %d", u.Name, idx, len(u.Inputs)-first, need)
+	}
+	if u.Name == "EnvGen" {
+		for i, node := range []*int{&env.ReleaseNode, &env.LoopNode} {
+			src := in(2 + i)
+			value, ok := resolveInput(def, src, overrides)
+			if !ok {
+				env.Warnings = append(env.Warnings, fmt.Sprintf("%s node is %s", []string{"release", "loop"}[i], describeSource(src)))
+				continue
+			}
+			if value != envNoNode {
+				*node = int(value)
+			}
+			if src.Kind == sourceParam {
+				env.Warnings = append(env.Warnings, fmt.Sprintf("%s node set by param %s", []string{"release", "loop"}[i], src.Param))
+			}
+		}
+	}
+	for s := 0; s < numSegments; s++ {
+		k := 4 + 4*s
+		seg := envSegment{Level: in(k), Time: in(k + 1)}
+		shapeIdx, curveIdx := k+2, k+3
+		if u.Name == "IEnvGen" {
+			seg.Time, seg.Level = in(k), in(k+3)
+			shapeIdx, curveIdx = k+1, k+2
+		}
+		shape, err := constant(shapeIdx, fmt.Sprintf("segment %d shape", s))
+		if err != nil {
+			return env, err
+		}
+		seg.Shape = envShapeName(shape)
+		if shape == envShapeCustom {
+			curve := in(curveIdx)
+			seg.Curve = &curve
+		}
+		env.shapes = append(env.shapes, shape)
+		env.Segments = append(env.Segments, seg)
+	}
+	for _, src := range env.sources() {
+		if src.Kind == sourceUgen {
+			env.Warnings = append(env.Warnings, fmt.Sprintf("%s is computed, plotted as 0", src))
+		}
+	}
+	for _, seg := range env.Segments {
+		t, _ := resolveInput(def, seg.Time, overrides)
+		env.Duration += float64(t)
+	}
+	return env, nil
+}
+
+// sources returns the sources of the levels, times, and curves of the envelope.
+func (env decodedEnvelope) sources() []inputSource {
+	srcs := []inputSource{env.Start}
+	for _, seg := range env.Segments {
+		srcs = append(srcs, seg.Level, seg.Time)
+		if seg.Curve != nil {
+			srcs = append(srcs, *seg.Curve)
+		}
+	}
+	return srcs
+}
+
+// levelAt returns the level of the envelope at a time, ignoring the release and loop nodes.
+func (env decodedEnvelope) levelAt(def *sc.Synthdef, overrides map[string]float32, t float64) float64 {
+	value := func(src inputSource) float64 {
+		v, _ := resolveInput(def, src, overrides)
+		return float64(v)
+	}
+	var (
+		level = value(env.Start)
+		start = 0.0
+	)
+	for i, seg := range env.Segments {
+		var (
+			dur   = value(seg.Time)
+			end   = value(seg.Level)
+			curve = 0.0
+		)
+		if seg.Curve != nil {
+			curve = value(*seg.Curve)
+		}
+		if t < start+dur {
+			return envLevel(env.shapes[i], curve, level, end, (t-start)/dur)
+		}
+		level, start = end, start+dur
+	}
+	return level
+}
+
+// envNode is a release or loop node of an envelope.
+type envNode struct {
+	mark  byte
+	color string
+	index int
+}
+
+// nodes returns the release and loop nodes of the envelope that can be plotted.
+func (env decodedEnvelope) nodes() []envNode {
+	nodes := []envNode{}
+	if env.Duration == 0 {
+		return nodes
+	}
+	if env.ReleaseNode != envNodeNone {
+		nodes = append(nodes, envNode{mark: 'R', color: "red", index: env.ReleaseNode})
+	}
+	if env.LoopNode != envNodeNone {
+		nodes = append(nodes, envNode{mark: 'L', color: "blue", index: env.LoopNode})
+	}
+	return nodes
+}
+
+// nodeTime returns the time at which the envelope reaches a node.
+func (env decodedEnvelope) nodeTime(def *sc.Synthdef, overrides map[string]float32, node int) float64 {
+	t := 0.0
+	for i := 0; i < node && i < len(env.Segments); i++ {
+		v, _ := resolveInput(def, env.Segments[i].Time, overrides)
+		t += float64(v)
+	}
+	return t
+}
+
+// synthdefEnvelopes decodes the envelopes of every EnvGen and IEnvGen of a synthdef.
+func synthdefEnvelopes(def *sc.Synthdef, overrides map[string]float32) ([]decodedEnvelope, error) {
+	envs := []decodedEnvelope{}
+	for i, u := range def.Ugens {
+		if _, ok := envInputOffsets[u.Name]; !ok {
+			continue
+		}
+		env, err := decodeEnvelope(def, i, overrides)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, env)
+	}
+	return envs, nil
+}
+
+// envelopes runs the envelopes command
+func (c *controller) envelopes() error {
+	fset := c.flagSets["envelopes"]
+
+	if fset.NArg() != 1 {
+		return errors.New("expected one synthdef file")
+	}
+	def, err := readSynthdefFile(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	envs, err := synthdefEnvelopes(def, c.envelopesParams)
+	if err != nil {
+		return err
+	}
+	if *c.envelopesSVG != "" {
+		f, err := os.Create(*c.envelopesSVG)
+		if err != nil {
+			return err
+		}
+		if err := writeEnvelopesSVG(f, def, c.envelopesParams, envs); err != nil {
+			_ = f.Close() // Best effort.
+			return errors.Wrap(err, "writing "+*c.envelopesSVG)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	switch *c.envelopesOutput {
+	case "json":
+		return writeJSON(os.Stdout, envs)
+	case "text":
+		return writeEnvelopes(os.Stdout, def, c.envelopesParams, envs, *c.envelopesPlot)
+	default:
+		return errors.Errorf("unsupported output format %q", *c.envelopesOutput)
+	}
+}
+
+// writeEnvelopes writes a human-readable description of each envelope,
+// followed by an ASCII plot if plot is true.
+func writeEnvelopes(w io.Writer, def *sc.Synthdef, overrides map[string]float32, envs []decodedEnvelope, plot bool) error {
+	for i, env := range envs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s(%d)", env.Ugen, env.UgenIndex)
+		if env.Offset != nil {
+			fmt.Fprintf(w, " offset %s", env.Offset)
+		}
+		fmt.Fprintf(w, ", %.3gs\n", env.Duration)
+		fmt.Fprintf(w, "  start at %s\n", env.Start)
+		for s, seg := range env.Segments {
+			shape := seg.Shape
+			if seg.Curve != nil {
+				shape = "curve " + seg.Curve.String()
+			}
+			var marks []string
+			if s+1 == env.ReleaseNode {
+				marks = append(marks, "release node")
+			}
+			if s+1 == env.LoopNode {
+				marks = append(marks, "loop node")
+			}
+			line := fmt.Sprintf("  %d: to %s over %s, %s", s, seg.Level, seg.Time, shape)
+			if len(marks) > 0 {
+				line += " (" + strings.Join(marks, ", ") + ")"
+			}
+			fmt.Fprintln(w, line)
+		}
+		for _, warning := range env.Warnings {
+			fmt.Fprintf(w, "  warning: %s\n", warning)
+		}
+		if plot {
+			writeEnvelopeASCII(w, def, overrides, env)
+		}
+	}
+	return nil
+}
+
+// envRange returns the lowest and highest level of an envelope plot.
+func envRange(levels []float64) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, l := range levels {
+		if math.IsNaN(l) || math.IsInf(l, 0) {
+			continue
+		}
+		lo, hi = math.Min(lo, l), math.Max(hi, l)
+	}
+	if math.IsInf(lo, 1) {
+		return 0, 1 // No finite levels.
+	}
+	if hi-lo < 1e-9 {
+		hi = lo + 1
+	}
+	return lo, hi
+}
+
+// envSamples samples the level of an envelope at n evenly spaced times.
+func envSamples(def *sc.Synthdef, overrides map[string]float32, env decodedEnvelope, n int) []float64 {
+	levels := make([]float64, n)
+	for i := range levels {
+		levels[i] = env.levelAt(def, overrides, env.Duration*float64(i)/float64(n-1))
+	}
+	return levels
+}
+
+// plotIndex scales a fraction from 0 to 1 onto an index from 0 to n-1. Fractions out of range,
+// e.g. from negative segment times, are clamped, and NaN has no index.
+func plotIndex(frac float64, n int) (int, bool) {
+	if math.IsNaN(frac) {
+		return 0, false
+	}
+	return int(math.Round(math.Max(0, math.Min(1, frac)) * float64(n-1))), true
+}
+
+// writeEnvelopeASCII writes an ASCII plot of an envelope. The release node is marked with R
+// and the loop node with L on the time axis.
+func writeEnvelopeASCII(w io.Writer, def *sc.Synthdef, overrides map[string]float32, env decodedEnvelope) {
+	var (
+		levels = envSamples(def, overrides, env, envPlotColumns)
+		lo, hi = envRange(levels)
+		grid   = make([][]byte, envPlotRows)
+	)
+	for r := range grid {
+		grid[r] = []byte(strings.Repeat(" ", envPlotColumns))
+	}
+	for col, l := range levels {
+		if row, ok := plotIndex((hi-l)/(hi-lo), envPlotRows); ok {
+			grid[row][col] = '*'
+		}
+	}
+	for r, line := range grid {
+		label := strings.Repeat(" ", 8)
+		switch r {
+		case 0:
+			label = fmt.Sprintf("%8.3g", hi)
+		case envPlotRows - 1:
+			label = fmt.Sprintf("%8.3g", lo)
+		}
+		fmt.Fprintf(w, "  %s |%s\n", label, strings.TrimRight(string(line), " "))
+	}
+	axis := []byte(strings.Repeat("-", envPlotColumns))
+	for _, node := range env.nodes() {
+		if col, ok := plotIndex(env.nodeTime(def, overrides, node.index)/env.Duration, envPlotColumns); ok {
+			axis[col] = node.mark
+		}
+	}
+	fmt.Fprintf(w, "  %8s +%s\n", "", axis)
+	fmt.Fprintf(w, "  %8s  0%*s\n", "", envPlotColumns-1, fmt.Sprintf("%.3gs", env.Duration))
+}
+
+// writeEnvelopesSVG writes an SVG with a plot of every envelope, one below the other.
+// The release node is marked with a dashed red line and the loop node with a dashed blue line.
+func writeEnvelopesSVG(w io.Writer, def *sc.Synthdef, overrides map[string]float32, envs []decodedEnvelope) error {
+	var (
+		plotHeight = envPlotHeight + 2*envPlotMargin
+		b          = &strings.Builder{}
+	)
+	fmt.Fprintf(b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"10\">\n", envPlotWidth+2*envPlotMargin, plotHeight*len(envs))
+	for i, env := range envs {
+		var (
+			top    = i*plotHeight + envPlotMargin
+			levels = envSamples(def, overrides, env, envPlotWidth)
+			lo, hi = envRange(levels)
+			lines  = [][]string{}
+			points = []string{}
+		)
+		// Levels that are not a number break the line, and infinite ones are clamped to the plot.
+		for x, l := range levels {
+			row, ok := plotIndex((hi-l)/(hi-lo), envPlotHeight+1)
+			if !ok {
+				lines, points = append(lines, points), []string{}
+				continue
+			}
+			points = append(points, fmt.Sprintf("%d,%d", envPlotMargin+x, top+row))
+		}
+		lines = append(lines, points)
+
+		fmt.Fprintf(b, "  <text x=\"%d\" y=\"%d\">%s(%d) %.3gs, %.3g to %.3g</text>\n", envPlotMargin, top-8, env.Ugen, env.UgenIndex, env.Duration, lo, hi)
+		fmt.Fprintf(b, "  <rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"none\" stroke=\"#ccc\"/>\n", envPlotMargin, top, envPlotWidth, envPlotHeight)
+		for _, node := range env.nodes() {
+			col, ok := plotIndex(env.nodeTime(def, overrides, node.index)/env.Duration, envPlotWidth)
+			if !ok {
+				continue
+			}
+			x := envPlotMargin + col
+			fmt.Fprintf(b, "  <line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\" stroke-dasharray=\"4\"/>\n", x, top, x, top+envPlotHeight, node.color)
+		}
+		for _, points := range lines {
+			if len(points) > 0 {
+				fmt.Fprintf(b, "  <polyline fill=\"none\" stroke=\"black\" points=\"%s\"/>\n", strings.Join(points, " "))
+			}
+		}
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
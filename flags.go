@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// assignments is a flag that can be repeated to assign numbers to names,
+// e.g. -set freq=220 -set amp=0.2
+type assignments map[string]float32
+
+// Set parses a name=value pair.
+func (a assignments) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return errors.Errorf("expected name=value, got %q", s)
+	}
+	v, err := strconv.ParseFloat(s[i+1:], 32)
+	if err != nil {
+		return errors.Wrapf(err, "parsing value of %s", s[:i])
+	}
+	a[s[:i]] = float32(v)
+	return nil
+}
+
+// String returns the assignments as a comma-separated list.
+func (a assignments) String() string {
+	pairs := make([]string, 0, len(a))
+	for k, v := range a {
+		pairs = append(pairs, k+"="+strconv.FormatFloat(float64(v), 'g', -1, 32))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// fileList is a flag that can be repeated to provide several files,
+// e.g. -catalog sc3-plugins.json -catalog ours.json
+type fileList []string
+
+// Set adds a file to the list.
+func (fl *fileList) Set(s string) error {
+	*fl = append(*fl, s)
+	return nil
+}
+
+// String returns the files as a comma-separated list.
+func (fl *fileList) String() string {
+	return strings.Join(*fl, ",")
+}
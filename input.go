@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/scgolang/sc"
+)
+
+// Kinds of input sources.
+const (
+	sourceConstant = "constant"
+	sourceParam    = "param"
+	sourceUgen     = "ugen"
+)
+
+// rateDemand is the calculation rate of demand rate ugens.
+// The sc package only defines constants for IR, KR, and AR.
+const rateDemand = 3
+
+// controlNames contains the names of the ugens that expose synthdef params.
+var controlNames = map[string]struct{}{
+	"AudioControl": struct{}{},
+	"Control":      struct{}{},
+	"LagControl":   struct{}{},
+	"TrigControl":  struct{}{},
+}
+
+// inputSource describes where the value of a ugen input comes from.
+// It is either a constant, a synthdef param, or the output of another ugen.
+type inputSource struct {
+	Kind        string
+	Value       float32
+	Param       string
+	ParamIndex  int32
+	Ugen        string
+	UgenIndex   int32
+	OutputIndex int32
+}
+
+// MarshalJSON only includes the fields that are relevant to the kind of source.
+func (src inputSource) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{"kind": src.Kind}
+
+	switch src.Kind {
+	case sourceConstant:
+		m["value"] = src.Value
+	case sourceParam:
+		m["param"] = src.Param
+		m["paramIndex"] = src.ParamIndex
+	default:
+		m["ugen"] = src.Ugen
+		m["ugenIndex"] = src.UgenIndex
+		m["outputIndex"] = src.OutputIndex
+	}
+	return json.Marshal(m)
+}
+
+// String returns a short description of the input source.
+func (src inputSource) String() string {
+	switch src.Kind {
+	case sourceConstant:
+		return fmt.Sprintf("%g", src.Value)
+	case sourceParam:
+		return "param " + src.Param
+	default:
+		return fmt.Sprintf("%s(%d)[%d]", src.Ugen, src.UgenIndex, src.OutputIndex)
+	}
+}
+
+// describeSource describes where the value of an input comes from,
+// e.g. "param bufnum" or "computed by LocalBuf(2)".
+func describeSource(src inputSource) string {
+	if src.Kind == sourceUgen {
+		return fmt.Sprintf("computed by %s(%d)", src.Ugen, src.UgenIndex)
+	}
+	return src.String()
+}
+
+// describeInput returns the source of a ugen input.
+func describeInput(def *sc.Synthdef, in sc.UgenInput) inputSource {
+	if in.IsConstant() {
+		return inputSource{Kind: sourceConstant, Value: def.Constants[in.OutputIndex]}
+	}
+	u := def.Ugens[in.UgenIndex]
+	if _, ok := controlNames[u.Name]; ok {
+		idx := int32(u.SpecialIndex) + in.OutputIndex
+		return inputSource{Kind: sourceParam, Param: paramName(def, idx), ParamIndex: idx}
+	}
+	return inputSource{
+		Kind:        sourceUgen,
+		Ugen:        u.Name,
+		UgenIndex:   in.UgenIndex,
+		OutputIndex: in.OutputIndex,
+	}
+}
+
+// paramName returns the name of the param at the provided index.
+// Params that are part of an array get the array offset appended to their name.
+func paramName(def *sc.Synthdef, idx int32) string {
+	for _, slice := range paramSlices(def) {
+		if idx < slice.Index || idx >= slice.Index+slice.Length {
+			continue
+		}
+		if slice.Length == 1 {
+			return slice.Name
+		}
+		return fmt.Sprintf("%s[%d]", slice.Name, idx-slice.Index)
+	}
+	return fmt.Sprintf("#%d", idx)
+}
+
+// rateName returns the name of a calculation rate.
+func rateName(rate int8) string {
+	switch rate {
+	case sc.IR:
+		return "scalar"
+	case sc.KR:
+		return "control"
+	case sc.AR:
+		return "audio"
+	case rateDemand:
+		return "demand"
+	}
+	return fmt.Sprintf("rate(%d)", rate)
+}
+
+// upstreamParams returns the names of the params that a ugen input depends on,
+// either directly or through any of the ugens that compute it.
+func upstreamParams(def *sc.Synthdef, in sc.UgenInput) map[string]struct{} {
+	var (
+		params = map[string]struct{}{}
+		seen   = map[int32]bool{}
+		walk   func(in sc.UgenInput)
+	)
+	walk = func(in sc.UgenInput) {
+		src := describeInput(def, in)
+		switch src.Kind {
+		case sourceParam:
+			params[src.Param] = struct{}{}
+		case sourceUgen:
+			if seen[src.UgenIndex] {
+				return
+			}
+			seen[src.UgenIndex] = true
+			for _, upstream := range def.Ugens[src.UgenIndex].Inputs {
+				walk(upstream)
+			}
+		}
+	}
+	walk(in)
+	return params
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// Node lifetime classes.
+const (
+	lifetimeSelfFreeing  = "self-freeing"
+	lifetimeGateReleased = "gate-released"
+	lifetimeNeverFreeing = "never-freeing"
+)
+
+// Actions of the ugens that free or pause their synth without a doneAction input.
+const (
+	freeSelfAction  = "FreeSelf"
+	pauseSelfAction = "PauseSelf"
+)
+
+const (
+	// gateParam is the name sclang uses for the param that releases an envelope.
+	gateParam = "gate"
+
+	// envNoNode is the value of an envelope's release or loop node when it has none.
+	envNoNode = -99
+
+	// envGenReleaseNodeIdx is the index of the release node in the inputs of EnvGen.
+	envGenReleaseNodeIdx = 7
+)
+
+// doneActionInput is the name of the catalog input that holds a ugen's done action.
+const doneActionInput = "doneAction"
+
+// doneActionInputs maps the names of ugens that have a doneAction input
+// to the index of that input. It is taken from the core catalog so the two agree.
+var doneActionInputs = doneActionIndexes(coreUgens)
+
+// doneActionIndexes returns the index of the doneAction input of every spec that has one.
+func doneActionIndexes(specs []ugenSpec) map[string]int {
+	indexes := map[string]int{}
+	for _, spec := range specs {
+		for i, in := range spec.Inputs {
+			if in.Name == doneActionInput {
+				indexes[spec.Name] = i
+			}
+		}
+	}
+	return indexes
+}
+
+// selfFreeingUgens are ugens that free or pause their synth without a doneAction input.
+var selfFreeingUgens = map[string]string{
+	"FreeSelf":          freeSelfAction,
+	"FreeSelfWhenDone":  freeSelfAction,
+	"PauseSelf":         pauseSelfAction,
+	"PauseSelfWhenDone": pauseSelfAction,
+}
+
+// doneActionNames contains the names of the done actions defined by the sc package.
+var doneActionNames = map[int]string{
+	sc.DoNothing:             "DoNothing",
+	sc.Pause:                 "Pause",
+	sc.FreeEnclosing:         "FreeEnclosing",
+	sc.FreePreceding:         "FreePreceding",
+	sc.FreeFollowing:         "FreeFollowing",
+	sc.FreePrecedingGroup:    "FreePrecedingGroup",
+	sc.FreeFollowingGroup:    "FreeFollowingGroup",
+	sc.FreeAllPreceding:      "FreeAllPreceding",
+	sc.FreeAllFollowing:      "FreeAllFollowing",
+	sc.FreeAndPausePreceding: "FreeAndPausePreceding",
+	sc.FreeAndPauseFollowing: "FreeAndPauseFollowing",
+	sc.DeepFreePreceding:     "DeepFreePreceding",
+	sc.DeepFreeFollowing:     "DeepFreeFollowing",
+	sc.FreeAllInGroup:        "FreeAllInGroup",
+}
+
+// doneActionName returns the name of a done action.
+func doneActionName(action int) string {
+	if name, ok := doneActionNames[action]; ok {
+		return name
+	}
+	return fmt.Sprintf("doneAction(%d)", action)
+}
+
+// freesSynth returns true if a done action frees the synth that contains the ugen.
+// Every done action from FreeEnclosing up does this.
+func freesSynth(action int) bool {
+	return action >= sc.FreeEnclosing
+}
+
+// doneActionUse is a ugen that can end the life of its synth.
+type doneActionUse struct {
+	Ugen       string       `json:"ugen"`
+	UgenIndex  int          `json:"ugenIndex"`
+	DoneAction *inputSource `json:"doneAction,omitempty"`
+	Action     string       `json:"action"`
+	Frees      bool         `json:"frees"`
+	Released   bool         `json:"released,omitempty"`
+	Gated      bool         `json:"gated,omitempty"`
+}
+
+// String returns a one-line description of the done action use.
+func (use doneActionUse) String() string {
+	s := fmt.Sprintf("%-20s %-22s", fmt.Sprintf("%s(%d)", use.Ugen, use.UgenIndex), use.Action)
+	if use.DoneAction != nil && use.DoneAction.Kind != sourceConstant {
+		s += " from " + describeSource(*use.DoneAction)
+	}
+	if use.Released {
+		if use.Gated {
+			s += " released by gate"
+		} else {
+			s += " has a release node"
+		}
+	}
+	return strings.TrimRight(s, " ")
+}
+
+// nodeLifetime is the node lifetime analysis of a synthdef.
+type nodeLifetime struct {
+	File     string          `json:"file"`
+	Synthdef string          `json:"synthdef"`
+	Class    string          `json:"class"`
+	Uses     []doneActionUse `json:"uses"`
+	Warnings []string        `json:"warnings,omitempty"`
+}
+
+// analyzeLifetime finds every ugen that can free its synth and classifies the synthdef.
+// Done actions that come from params are resolved with the initial value of the param.
+func analyzeLifetime(def *sc.Synthdef) nodeLifetime {
+	lt := nodeLifetime{Synthdef: def.Name, Uses: []doneActionUse{}}
+
+	for i, u := range def.Ugens {
+		if action, ok := selfFreeingUgens[u.Name]; ok {
+			lt.Uses = append(lt.Uses, doneActionUse{
+				Ugen:      u.Name,
+				UgenIndex: i,
+				Action:    action,
+				Frees:     action == freeSelfAction,
+			})
+			continue
+		}
+		idx, ok := doneActionInputs[u.Name]
+		if !ok || idx >= len(u.Inputs) {
+			continue
+		}
+		var (
+			src           = describeInput(def, u.Inputs[idx])
+			value, static = resolveInput(def, src, nil)
+			use           = doneActionUse{Ugen: u.Name, UgenIndex: i, DoneAction: &src}
+		)
+		if !static {
+			use.Action = "computed"
+			lt.Warnings = append(lt.Warnings, fmt.Sprintf("%s(%d) has a doneAction computed by %s(%d)", u.Name, i, src.Ugen, src.UgenIndex))
+		} else {
+			use.Action = doneActionName(int(value))
+			use.Frees = freesSynth(int(value))
+		}
+		if src.Kind == sourceParam {
+			lt.Warnings = append(lt.Warnings, fmt.Sprintf("%s(%d) has its doneAction set by param %s (initial value %s)", u.Name, i, src.Param, use.Action))
+		}
+		switch u.Name {
+		case "EnvGen":
+			use.Released = envGenHasReleaseNode(def, u)
+		case "Linen":
+			use.Released = true
+		}
+		if use.Released {
+			_, use.Gated = upstreamParams(def, u.Inputs[0])[gateParam]
+		}
+		if use.Released && use.Gated && !use.Frees && static {
+			lt.Warnings = append(lt.Warnings, fmt.Sprintf("%s(%d) is released by gate but its doneAction is %s, so releasing the synth will not free it", u.Name, i, use.Action))
+		}
+		if use.Released && !use.Gated && use.Frees {
+			lt.Warnings = append(lt.Warnings, fmt.Sprintf("%s(%d) has a release node but its gate does not depend on a %s param", u.Name, i, gateParam))
+		}
+		lt.Uses = append(lt.Uses, use)
+	}
+	lt.Class = lt.classify()
+	return lt
+}
+
+// classify classifies a synthdef by the way its nodes end.
+func (lt *nodeLifetime) classify() string {
+	class := lifetimeNeverFreeing
+	for _, use := range lt.Uses {
+		if !use.Frees {
+			continue
+		}
+		if use.Released && use.Gated {
+			return lifetimeGateReleased
+		}
+		if !use.Released {
+			class = lifetimeSelfFreeing
+		}
+	}
+	return class
+}
+
+// envGenHasReleaseNode returns true if an EnvGen's envelope has a release node.
+func envGenHasReleaseNode(def *sc.Synthdef, u *sc.Ugen) bool {
+	if envGenReleaseNodeIdx >= len(u.Inputs) {
+		return false
+	}
+	src := describeInput(def, u.Inputs[envGenReleaseNodeIdx])
+	if src.Kind != sourceConstant {
+		return true
+	}
+	return src.Value != envNoNode
+}
+
+// lifetime runs the lifetime command
+func (c *controller) lifetime() error {
+	fset := c.flagSets["lifetime"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file")
+	}
+	var (
+		reports = []nodeLifetime{}
+		never   = 0
+	)
+	for _, path := range fset.Args() {
+		def, err := readSynthdefFile(path)
+		if err != nil {
+			return err
+		}
+		lt := analyzeLifetime(def)
+		lt.File = path
+		if lt.Class == lifetimeNeverFreeing {
+			never++
+		}
+		reports = append(reports, lt)
+	}
+	var err error
+	switch *c.lifetimeOutput {
+	case "json":
+		err = writeJSON(os.Stdout, reports)
+	case "text":
+		err = writeLifetimes(os.Stdout, reports)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.lifetimeOutput)
+	}
+	if err != nil {
+		return err
+	}
+	if *c.lifetimeStrict && never > 0 {
+		return errors.Errorf("found %d never-freeing synthdef(s)", never)
+	}
+	return nil
+}
+
+// writeLifetimes writes a human-readable lifetime report.
+func writeLifetimes(w io.Writer, reports []nodeLifetime) error {
+	for _, lt := range reports {
+		fmt.Fprintf(w, "%s (%s): %s\n", lt.File, lt.Synthdef, lt.Class)
+		for _, use := range lt.Uses {
+			fmt.Fprintf(w, "  %s\n", use)
+		}
+		for _, warning := range lt.Warnings {
+			fmt.Fprintf(w, "  warning: %s\n", warning)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,675 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// Values of the ugens and inputs that lint -fix inserts.
+const (
+	lintLimiterLevel = 1
+	lintLimiterDur   = 0.01
+	lintLeakDCCoef   = 0.995
+)
+
+// limitingUnaryOps and limitingBinaryOps contain the operators that bound their output.
+var (
+	limitingUnaryOps  = map[string]bool{"distort": true, "softclip": true, "tanh": true}
+	limitingBinaryOps = map[string]bool{"clip2": true, "fold2": true, "wrap2": true}
+)
+
+// limitingUgens are ugens that bound their output.
+var limitingUgens = map[string]bool{
+	"Clip":       true,
+	"Fold":       true,
+	"Limiter":    true,
+	"Normalizer": true,
+	"Wrap":       true,
+}
+
+// dcBlockingUgens are ugens that remove DC from their input.
+var dcBlockingUgens = map[string]bool{
+	"BBandPass": true,
+	"BHiPass":   true,
+	"BHiPass4":  true,
+	"BPF":       true,
+	"BPZ2":      true,
+	"Formlet":   true,
+	"HPF":       true,
+	"HPZ1":      true,
+	"HPZ2":      true,
+	"LeakDC":    true,
+	"RHPF":      true,
+	"Resonz":    true,
+	"Ringz":     true,
+}
+
+// dcSourceUgens are ugens whose output has a DC offset.
+var dcSourceUgens = map[string]bool{
+	"DC":      true,
+	"Dust":    true,
+	"Impulse": true,
+	"LFPulse": true,
+	"Phasor":  true,
+	"Sweep":   true,
+	"Trig":    true,
+	"Trig1":   true,
+}
+
+// passThroughInputs are the names of the inputs whose signal a ugen passes on,
+// e.g. the input of a filter.
+var passThroughInputs = map[string]bool{"in": true, "inA": true, "inB": true, "left": true, "right": true}
+
+// lintRule is a named check of a synthdef.
+type lintRule struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Fixable     bool   `json:"fixable"`
+
+	check func(l *linter) []lintIssue
+
+	// fix fixes an issue found by check and returns false if it could not.
+	fix func(def *sc.Synthdef, issue lintIssue) bool
+}
+
+// lintRules contains every lint rule. Fixes are applied in this order,
+// so a LeakDC inserted before an Out ends up before the Limiter.
+var lintRules = []lintRule{
+	{
+		Name:        "dc-leak",
+		Description: "a DC offset reaches an audio Out without a LeakDC",
+		Fixable:     true,
+		check:       lintDCLeak,
+		fix: func(def *sc.Synthdef, issue lintIssue) bool {
+			return insertBefore(def, issue.ugen, issue.Input, "LeakDC", lintLeakDCCoef)
+		},
+	},
+	{
+		Name:        "feedback-damping",
+		Description: "LocalIn feeds back into LocalOut without being scaled down or limited",
+		check:       lintFeedbackDamping,
+	},
+	{
+		Name:        "gated-done-action",
+		Description: "a synth with a gate param has an EnvGen with doneAction 0 and is never freed",
+		Fixable:     true,
+		check:       lintGatedDoneAction,
+		fix:         fixDoneAction,
+	},
+	{
+		Name:        "hardcoded-bus",
+		Description: "a bus ugen uses a constant bus number instead of a param",
+		check:       lintHardcodedBus,
+	},
+	{
+		Name:        "out-limiter",
+		Description: "an audio source reaches an audio Out without a Limiter or clip",
+		Fixable:     true,
+		check:       lintOutLimiter,
+		fix: func(def *sc.Synthdef, issue lintIssue) bool {
+			return insertBefore(def, issue.ugen, issue.Input, "Limiter", lintLimiterLevel, lintLimiterDur)
+		},
+	},
+}
+
+// lintIssue is a single problem found by a lint rule.
+type lintIssue struct {
+	Rule      string `json:"rule"`
+	Ugen      string `json:"ugen"`
+	UgenIndex int    `json:"ugenIndex"`
+	Input     int    `json:"input"`
+	Message   string `json:"message"`
+	Fixed     bool   `json:"fixed,omitempty"`
+
+	// ugen is the ugen the issue is about. Fixes use it to find the ugen
+	// after other fixes have moved it.
+	ugen *sc.Ugen
+}
+
+// lintConfig switches rules on and off.
+type lintConfig struct {
+	// Rules maps rule names to whether they are enabled. Rules are enabled by default.
+	Rules map[string]bool `json:"rules"`
+
+	// Suppress maps synthdef names to the rules that are not checked for them.
+	// The rule name "*" suppresses every rule.
+	Suppress map[string][]string `json:"suppress"`
+}
+
+// readLintConfig reads a lint config from a JSON file.
+func readLintConfig(path string) (*lintConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	cfg := &lintConfig{}
+	if err := json.NewDecoder(f).Decode(cfg); err != nil {
+		return nil, errors.Wrap(err, "decoding "+path)
+	}
+	for name := range cfg.Rules {
+		if _, ok := lookupLintRule(name); !ok {
+			return nil, errors.Errorf("unknown lint rule %q in %s", name, path)
+		}
+	}
+	return cfg, nil
+}
+
+// enabled returns true if a rule should be checked for a synthdef.
+func (cfg *lintConfig) enabled(rule, synthdef string) bool {
+	if on, ok := cfg.Rules[rule]; ok && !on {
+		return false
+	}
+	suppressed := cfg.Suppress[synthdef]
+	return !containsString(suppressed, rule) && !containsString(suppressed, "*")
+}
+
+// lookupLintRule returns the rule with the provided name.
+func lookupLintRule(name string) (lintRule, bool) {
+	for _, rule := range lintRules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return lintRule{}, false
+}
+
+// linter checks a single synthdef.
+type linter struct {
+	def *sc.Synthdef
+	cat ugenCatalog
+}
+
+// issue creates an issue about an input of a ugen.
+func (l *linter) issue(idx, input int, format string, args ...interface{}) lintIssue {
+	u := l.def.Ugens[idx]
+	return lintIssue{
+		Ugen:      u.Name,
+		UgenIndex: idx,
+		Input:     input,
+		Message:   fmt.Sprintf("%s(%d) %s: ", u.Name, idx, l.cat.inputName(u, input)) + fmt.Sprintf(format, args...),
+		ugen:      u,
+	}
+}
+
+// audioOutChannels calls fn with every channel input of every audio rate ugen
+// that writes to a bus that is not local to the synth.
+func (l *linter) audioOutChannels(fn func(idx, input int)) {
+	for i, u := range l.def.Ugens {
+		bu, ok := busUgens[u.Name]
+		if !ok || !bu.write || bu.local || u.Rate != sc.AR {
+			continue
+		}
+		for ii := bu.firstChannel; ii < len(u.Inputs); ii++ {
+			fn(i, ii)
+		}
+	}
+}
+
+// isAudio returns true if an input is the output of an audio rate ugen.
+func (l *linter) isAudio(in sc.UgenInput) bool {
+	return !in.IsConstant() && l.def.Ugens[in.UgenIndex].Rate == sc.AR
+}
+
+// isLimiting returns true if a ugen bounds its output.
+func isLimiting(u *sc.Ugen) bool {
+	switch u.Name {
+	case "UnaryOpUGen":
+		return limitingUnaryOps[operatorName(u)]
+	case "BinaryOpUGen":
+		return limitingBinaryOps[operatorName(u)]
+	}
+	return limitingUgens[u.Name]
+}
+
+// unlimitedSource returns the index of an audio source that reaches an input
+// without passing through a ugen that bounds its output.
+// Audio sources are audio rate ugens that have no audio rate inputs.
+func (l *linter) unlimitedSource(in sc.UgenInput, seen map[int32]bool) (int, bool) {
+	if !l.isAudio(in) || seen[in.UgenIndex] {
+		return 0, false
+	}
+	seen[in.UgenIndex] = true
+
+	u := l.def.Ugens[in.UgenIndex]
+	if isLimiting(u) {
+		return 0, false
+	}
+	source := true
+	for _, uin := range u.Inputs {
+		if !l.isAudio(uin) {
+			continue
+		}
+		source = false
+		if idx, ok := l.unlimitedSource(uin, seen); ok {
+			return idx, true
+		}
+	}
+	return int(in.UgenIndex), source
+}
+
+// lintOutLimiter checks that the signal of every audio Out is limited.
+func lintOutLimiter(l *linter) []lintIssue {
+	issues := []lintIssue{}
+	l.audioOutChannels(func(idx, input int) {
+		src, ok := l.unlimitedSource(l.def.Ugens[idx].Inputs[input], map[int32]bool{})
+		if !ok {
+			return
+		}
+		issues = append(issues, l.issue(idx, input, "%s(%d) reaches the output without a Limiter or clip", l.def.Ugens[src].Name, src))
+	})
+	return issues
+}
+
+// dcSource returns the index of a ugen that puts a DC offset on an input.
+// It follows the signal through pass-through inputs, sums, and scaling by non-audio values,
+// and stops at ugens that remove DC and at products of two audio signals.
+func (l *linter) dcSource(in sc.UgenInput, seen map[int32]bool) (int, bool) {
+	if !l.isAudio(in) || seen[in.UgenIndex] {
+		return 0, false
+	}
+	seen[in.UgenIndex] = true
+
+	var (
+		idx    = int(in.UgenIndex)
+		u      = l.def.Ugens[idx]
+		follow = []sc.UgenInput{}
+	)
+	if dcBlockingUgens[u.Name] {
+		return 0, false
+	}
+	if dcSourceUgens[u.Name] {
+		return idx, true
+	}
+	switch op := operatorName(u); {
+	case u.Name == "BinaryOpUGen" && (op == "+" || op == "-") && len(u.Inputs) == 2:
+		for _, uin := range u.Inputs {
+			if l.isOffset(uin) {
+				return idx, true
+			}
+		}
+		follow = u.Inputs
+	case u.Name == "BinaryOpUGen" && op == "*" && len(u.Inputs) == 2:
+		if l.isAudio(u.Inputs[0]) && l.isAudio(u.Inputs[1]) {
+			return 0, false
+		}
+		follow = u.Inputs
+	case u.Name == "BinaryOpUGen" && op == "/" && len(u.Inputs) == 2:
+		if !l.isAudio(u.Inputs[1]) {
+			follow = u.Inputs[:1]
+		}
+	case u.Name == "MulAdd" && len(u.Inputs) == 3:
+		if l.isOffset(u.Inputs[2]) {
+			return idx, true
+		}
+		if !l.isAudio(u.Inputs[1]) {
+			follow = []sc.UgenInput{u.Inputs[0], u.Inputs[2]}
+		}
+	default:
+		for ii, uin := range u.Inputs {
+			if passThroughInputs[l.cat.inputName(u, ii)] {
+				follow = append(follow, uin)
+			}
+		}
+	}
+	for _, uin := range follow {
+		if src, ok := l.dcSource(uin, seen); ok {
+			return src, true
+		}
+	}
+	return 0, false
+}
+
+// isOffset returns true if an input is a non-zero constant or a param with a non-zero initial value.
+func (l *linter) isOffset(in sc.UgenInput) bool {
+	src := describeInput(l.def, in)
+	if src.Kind == sourceUgen {
+		return false
+	}
+	value, _ := resolveInput(l.def, src, nil)
+	return value != 0
+}
+
+// lintDCLeak checks that no DC offset reaches an audio Out.
+func lintDCLeak(l *linter) []lintIssue {
+	issues := []lintIssue{}
+	l.audioOutChannels(func(idx, input int) {
+		src, ok := l.dcSource(l.def.Ugens[idx].Inputs[input], map[int32]bool{})
+		if !ok {
+			return
+		}
+		issues = append(issues, l.issue(idx, input, "%s(%d) puts a DC offset on the output and there is no LeakDC", l.def.Ugens[src].Name, src))
+	})
+	return issues
+}
+
+// isDamping returns true if a ugen scales its input down or bounds it.
+// Scale factors that come from params are resolved with their initial values.
+func (l *linter) isDamping(u *sc.Ugen) bool {
+	if isLimiting(u) {
+		return true
+	}
+	gain := func(in sc.UgenInput) (float64, bool) {
+		src := describeInput(l.def, in)
+		if src.Kind == sourceUgen {
+			return 0, false
+		}
+		value, _ := resolveInput(l.def, src, nil)
+		return math.Abs(float64(value)), true
+	}
+	switch op := operatorName(u); {
+	case u.Name == "BinaryOpUGen" && op == "*" && len(u.Inputs) == 2:
+		for _, in := range u.Inputs {
+			if g, ok := gain(in); ok && g < 1 {
+				return true
+			}
+		}
+	case u.Name == "BinaryOpUGen" && op == "/" && len(u.Inputs) == 2:
+		g, ok := gain(u.Inputs[1])
+		return ok && g > 1
+	case u.Name == "MulAdd" && len(u.Inputs) == 3:
+		g, ok := gain(u.Inputs[1])
+		return ok && g < 1
+	}
+	return false
+}
+
+// undampedFeedback returns true if a LocalIn reaches an input without passing through a damping ugen.
+func (l *linter) undampedFeedback(in sc.UgenInput, seen map[int32]bool) bool {
+	if in.IsConstant() || seen[in.UgenIndex] {
+		return false
+	}
+	seen[in.UgenIndex] = true
+
+	u := l.def.Ugens[in.UgenIndex]
+	if u.Name == "LocalIn" {
+		return true
+	}
+	if l.isDamping(u) {
+		return false
+	}
+	for _, uin := range u.Inputs {
+		if l.undampedFeedback(uin, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// lintFeedbackDamping checks that every LocalIn/LocalOut feedback loop is damped.
+func lintFeedbackDamping(l *linter) []lintIssue {
+	issues := []lintIssue{}
+	for i, u := range l.def.Ugens {
+		if u.Name != "LocalOut" {
+			continue
+		}
+		for ii, in := range u.Inputs {
+			if l.undampedFeedback(in, map[int32]bool{}) {
+				issues = append(issues, l.issue(i, ii, "LocalIn feeds back without being scaled down or limited"))
+			}
+		}
+	}
+	return issues
+}
+
+// lintGatedDoneAction checks that a synth with a gate param can be freed.
+// EnvGens with doneAction 0 are only reported if nothing else frees the synth,
+// since synths often have envelopes (e.g. for a filter) that are not meant to free them.
+// If the gate param releases exactly one EnvGen, only that one is reported.
+func lintGatedDoneAction(l *linter) []lintIssue {
+	issues := []lintIssue{}
+	lt := analyzeLifetime(l.def)
+	if !hasParam(l.def, gateParam) || lt.Class != lifetimeNeverFreeing {
+		return issues
+	}
+	release, single := releaseEnvGen(l.def)
+	for _, use := range lt.Uses {
+		if use.Ugen != "EnvGen" || use.Action != doneActionName(sc.DoNothing) {
+			continue
+		}
+		if single && use.UgenIndex != release {
+			continue
+		}
+		issue := l.issue(use.UgenIndex, doneActionInputs[use.Ugen], "doneAction is 0 in a synth with a %s param, so the synth is never freed", gateParam)
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// fixDoneAction sets the doneAction of an EnvGen to FreeEnclosing if it is the one EnvGen
+// released by the gate param. Any other EnvGen, e.g. a filter envelope, would free the synth
+// while it is still sounding, and if several are released by the gate param there is no
+// telling which should free it, so those are left alone, as are done actions that come from params.
+func fixDoneAction(def *sc.Synthdef, issue lintIssue) bool {
+	in := issue.ugen.Inputs[issue.Input]
+	if !in.IsConstant() {
+		return false
+	}
+	if release, single := releaseEnvGen(def); !single || def.Ugens[release] != issue.ugen {
+		return false
+	}
+	issue.ugen.Inputs[issue.Input] = addConstant(def, sc.FreeEnclosing)
+	return true
+}
+
+// releaseEnvGen returns the index of the EnvGen whose gate input depends on the gate param,
+// and false if there is not exactly one.
+func releaseEnvGen(def *sc.Synthdef) (int, bool) {
+	release, n := 0, 0
+	for i, u := range def.Ugens {
+		if u.Name != "EnvGen" || len(u.Inputs) == 0 {
+			continue
+		}
+		if _, ok := upstreamParams(def, u.Inputs[0])[gateParam]; ok {
+			release, n = i, n+1
+		}
+	}
+	return release, n == 1
+}
+
+// lintHardcodedBus checks that bus numbers come from params.
+func lintHardcodedBus(l *linter) []lintIssue {
+	issues := []lintIssue{}
+	for _, ba := range busAccesses(l.def) {
+		if ba.Bus == nil || ba.Bus.Kind != sourceConstant {
+			continue
+		}
+		issues = append(issues, l.issue(ba.UgenIndex, busUgens[ba.Ugen].busInput, "bus is hard-coded to %g, use a param instead", ba.Bus.Value))
+	}
+	return issues
+}
+
+// addConstant returns an input for a constant, adding the constant to the synthdef if needed.
+func addConstant(def *sc.Synthdef, value float32) sc.UgenInput {
+	for i, c := range def.Constants {
+		if math.Float32bits(c) == math.Float32bits(value) {
+			return sc.UgenInput{UgenIndex: -1, OutputIndex: int32(i)}
+		}
+	}
+	def.Constants = append(def.Constants, value)
+	return sc.UgenInput{UgenIndex: -1, OutputIndex: int32(len(def.Constants) - 1)}
+}
+
+// insertBefore inserts an audio rate ugen between an input of a ugen and whatever feeds it.
+// The input becomes the first input of the new ugen, followed by the constant args.
+// The new ugen goes right before the ugen it feeds, and the indices of the ugens after it are shifted.
+func insertBefore(def *sc.Synthdef, target *sc.Ugen, input int, name string, args ...float32) bool {
+	at := -1
+	for i, u := range def.Ugens {
+		if u == target {
+			at = i
+		}
+	}
+	if at == -1 || input >= len(target.Inputs) {
+		return false
+	}
+	u := &sc.Ugen{
+		Name:    name,
+		Rate:    sc.AR,
+		Inputs:  []sc.UgenInput{target.Inputs[input]},
+		Outputs: []sc.Output{sc.AR},
+	}
+	for _, arg := range args {
+		u.Inputs = append(u.Inputs, addConstant(def, arg))
+	}
+	def.Ugens = append(def.Ugens, nil)
+	copy(def.Ugens[at+1:], def.Ugens[at:])
+	def.Ugens[at] = u
+
+	for _, later := range def.Ugens[at+1:] {
+		for ii, in := range later.Inputs {
+			if !in.IsConstant() && in.UgenIndex >= int32(at) {
+				later.Inputs[ii].UgenIndex++
+			}
+		}
+	}
+	target.Inputs[input] = sc.UgenInput{UgenIndex: int32(at), OutputIndex: 0}
+	return true
+}
+
+// lintReport is the lint report for a single synthdef file.
+type lintReport struct {
+	File     string      `json:"file"`
+	Synthdef string      `json:"synthdef"`
+	Issues   []lintIssue `json:"issues"`
+}
+
+// remaining returns the number of issues that were not fixed.
+func (r lintReport) remaining() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if !issue.Fixed {
+			n++
+		}
+	}
+	return n
+}
+
+// lintSynthdef checks a synthdef with every enabled rule.
+// If fix is true, fixable issues are fixed in place and marked as fixed.
+func lintSynthdef(entry libraryEntry, cat ugenCatalog, cfg *lintConfig, fix bool) lintReport {
+	var (
+		def    = entry.Def
+		report = lintReport{File: entry.Path, Synthdef: def.Name, Issues: []lintIssue{}}
+		l      = &linter{def: def, cat: cat}
+	)
+	for _, rule := range lintRules {
+		if !cfg.enabled(rule.Name, def.Name) {
+			continue
+		}
+		for _, issue := range rule.check(l) {
+			issue.Rule = rule.Name
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+	if !fix {
+		return report
+	}
+	// Fix in rule order, after every rule has seen the original synthdef.
+	for _, rule := range lintRules {
+		if rule.fix == nil {
+			continue
+		}
+		for i, issue := range report.Issues {
+			if issue.Rule == rule.Name {
+				report.Issues[i].Fixed = rule.fix(def, issue)
+			}
+		}
+	}
+	return report
+}
+
+// lint runs the lint command
+func (c *controller) lint() error {
+	fset := c.flagSets["lint"]
+
+	if *c.lintList {
+		return writeLintRules(os.Stdout)
+	}
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file or directory")
+	}
+	cat, err := c.loadCatalog()
+	if err != nil {
+		return err
+	}
+	cfg := &lintConfig{}
+	if *c.lintConfig != "" {
+		if cfg, err = readLintConfig(*c.lintConfig); err != nil {
+			return err
+		}
+	}
+	var (
+		reports   = []lintReport{}
+		remaining = 0
+	)
+	for _, path := range fset.Args() {
+		entries, err := readSynthdefPath(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			report := lintSynthdef(entry, cat, cfg, *c.lintFix)
+			if report.remaining() < len(report.Issues) {
+				if err := writeSynthdefFile(entry.Path, entry.Def); err != nil {
+					return err
+				}
+			}
+			remaining += report.remaining()
+			reports = append(reports, report)
+		}
+	}
+	switch *c.lintOutput {
+	case "json":
+		err = writeJSON(os.Stdout, reports)
+	case "text":
+		err = writeLint(os.Stdout, reports)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.lintOutput)
+	}
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return errors.Errorf("found %d lint issue(s)", remaining)
+	}
+	return nil
+}
+
+// writeLint writes a human-readable lint report.
+func writeLint(w io.Writer, reports []lintReport) error {
+	for _, report := range reports {
+		if len(report.Issues) == 0 {
+			fmt.Fprintf(w, "%s (%s): ok\n", report.File, report.Synthdef)
+			continue
+		}
+		fmt.Fprintf(w, "%s (%s): %d issue(s)\n", report.File, report.Synthdef, len(report.Issues))
+		for _, issue := range report.Issues {
+			s := fmt.Sprintf("  %s: %s", issue.Rule, issue.Message)
+			if issue.Fixed {
+				s += " (fixed)"
+			}
+			fmt.Fprintln(w, s)
+		}
+	}
+	return nil
+}
+
+// writeLintRules writes the list of lint rules.
+func writeLintRules(w io.Writer) error {
+	for _, rule := range lintRules {
+		fixable := ""
+		if rule.Fixable {
+			fixable = " (fixable)"
+		}
+		fmt.Fprintf(w, "%-18s %s%s\n", rule.Name, rule.Description, fixable)
+	}
+	return nil
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"encoding/json"
+	"encoding/xml"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/scgolang/sc"
@@ -44,6 +48,121 @@ type controller struct {
 	command  string
 	output   *string
 	flagSets map[string]*flag.FlagSet
+
+	// catalogFiles are JSON files that extend the ugen catalog.
+	catalogFiles fileList
+
+	canonicalizeOutput *string
+
+	catalogOutput *string
+
+	buffersChannels assignments
+	buffersOutput   *string
+
+	busesOutput *string
+
+	checkOrderDir *string
+
+	compatOutput  *string
+	compatPlugins fileList
+	compatProfile *string
+	compatVersion *string
+
+	diffAudio      *bool
+	diffBlockSize  *int
+	diffChannels   *int
+	diffDuration   *float64
+	diffOutput     *string
+	diffParams     assignments
+	diffRelease    *float64
+	diffSampleRate *float64
+	diffSeed       *int64
+	diffTolerance  *float64
+
+	envelopesOutput *string
+	envelopesParams assignments
+	envelopesPlot   *bool
+	envelopesSVG    *string
+
+	hashIgnoreName *bool
+
+	lifetimeOutput *string
+	lifetimeStrict *bool
+
+	lintConfig *string
+	lintFix    *bool
+	lintList   *bool
+	lintOutput *string
+
+	midi2scoreEnd    *float64
+	midi2scoreFormat *string
+	midi2scoreMap    *string
+	midi2scoreOut    *string
+
+	paramsOutput *string
+	paramsStrict *bool
+
+	playAddr     *string
+	playDuration *time.Duration
+	playNode     *int
+	playParams   assignments
+	playTCP      *bool
+	playTimeout  *time.Duration
+
+	queryOutput *string
+
+	scoreDumpOutput *string
+
+	sendAddr      *string
+	sendLoadDir   *string
+	sendOutput    *string
+	sendServerDir *string
+	sendTCP       *bool
+	sendTimeout   *time.Duration
+
+	scoreEnd    *float64
+	scoreEvents *string
+	scoreOut    *string
+
+	similarOutput    *string
+	similarThreshold *float64
+
+	renderBits       *int
+	renderBlockSize  *int
+	renderChannels   *int
+	renderDuration   *float64
+	renderOut        *string
+	renderParams     assignments
+	renderRelease    *float64
+	renderSampleRate *float64
+	renderSeed       *int64
+
+	resourcesBlockSize  *int
+	resourcesInstances  *int
+	resourcesOutput     *string
+	resourcesRTMemory   *int
+	resourcesSampleRate *float64
+	resourcesWireBufs   *int
+
+	routingHWInputs  *int
+	routingHWOutputs *int
+	routingOutput    *string
+	routingParams    *string
+
+	testOutput *string
+	testUpdate *bool
+
+	watchAddr      *string
+	watchDebounce  *time.Duration
+	watchDuration  *time.Duration
+	watchInterval  *time.Duration
+	watchLoadDir   *string
+	watchNode      *int
+	watchParams    assignments
+	watchPlay      *bool
+	watchServerDir *string
+	watchTCP       *bool
+	watchTimeout   *time.Duration
 }
 
 func newController() *controller {
@@ -51,7 +170,127 @@ func newController() *controller {
 	c.flagSets = make(map[string]*flag.FlagSet)
 	c.flagSets["format"] = flag.NewFlagSet("format", flag.ExitOnError)
 	c.flagSets["diff"] = flag.NewFlagSet("diff", flag.ExitOnError)
+	c.flagSets["buffers"] = flag.NewFlagSet("buffers", flag.ExitOnError)
+	c.flagSets["canonicalize"] = flag.NewFlagSet("canonicalize", flag.ExitOnError)
+	c.flagSets["catalog"] = flag.NewFlagSet("catalog", flag.ExitOnError)
+	c.flagSets["buses"] = flag.NewFlagSet("buses", flag.ExitOnError)
+	c.flagSets["check-order"] = flag.NewFlagSet("check-order", flag.ExitOnError)
+	c.flagSets["compat"] = flag.NewFlagSet("compat", flag.ExitOnError)
+	c.flagSets["envelopes"] = flag.NewFlagSet("envelopes", flag.ExitOnError)
+	c.flagSets["hash"] = flag.NewFlagSet("hash", flag.ExitOnError)
+	c.flagSets["lifetime"] = flag.NewFlagSet("lifetime", flag.ExitOnError)
+	c.flagSets["lint"] = flag.NewFlagSet("lint", flag.ExitOnError)
+	c.flagSets["params"] = flag.NewFlagSet("params", flag.ExitOnError)
+	c.flagSets["play"] = flag.NewFlagSet("play", flag.ExitOnError)
+	c.flagSets["query"] = flag.NewFlagSet("query", flag.ExitOnError)
+	c.flagSets["render"] = flag.NewFlagSet("render", flag.ExitOnError)
+	c.flagSets["resources"] = flag.NewFlagSet("resources", flag.ExitOnError)
+	c.flagSets["routing"] = flag.NewFlagSet("routing", flag.ExitOnError)
+	c.flagSets["midi2score"] = flag.NewFlagSet("midi2score", flag.ExitOnError)
+	c.flagSets["score"] = flag.NewFlagSet("score", flag.ExitOnError)
+	c.flagSets["score-dump"] = flag.NewFlagSet("score-dump", flag.ExitOnError)
+	c.flagSets["send"] = flag.NewFlagSet("send", flag.ExitOnError)
+	c.flagSets["similar"] = flag.NewFlagSet("similar", flag.ExitOnError)
+	c.flagSets["test"] = flag.NewFlagSet("test", flag.ExitOnError)
+	c.flagSets["watch"] = flag.NewFlagSet("watch", flag.ExitOnError)
 	c.output = c.flagSets["format"].String("output", "json", "output format")
+	for _, name := range []string{"canonicalize", "catalog", "compat", "format", "hash", "lint", "params", "query", "watch"} {
+		c.flagSets[name].Var(&c.catalogFiles, "catalog", "JSON file of ugen specs that extends the built-in catalog (repeatable)")
+	}
+	c.buffersChannels = assignments{}
+	c.flagSets["buffers"].Var(c.buffersChannels, "channels", "actual channel count of a buffer, e.g. bufnum=2 or 0=1 (repeatable)")
+	c.buffersOutput = c.flagSets["buffers"].String("output", "text", "output format (text or json)")
+	c.busesOutput = c.flagSets["buses"].String("output", "text", "output format (text or json)")
+	c.canonicalizeOutput = c.flagSets["canonicalize"].String("out", "", "file to write the canonical synthdef to (default stdout)")
+	c.catalogOutput = c.flagSets["catalog"].String("output", "text", "output format (text or json)")
+	c.checkOrderDir = c.flagSets["check-order"].String("dir", ".", "directory containing the synthdefs")
+	c.compatOutput = c.flagSets["compat"].String("output", "text", "output format (text or json)")
+	c.flagSets["compat"].Var(&c.compatPlugins, "plugins", "directory of installed plugin .so/.scx files, including the core ones (repeatable)")
+	c.compatProfile = c.flagSets["compat"].String("profile", "", "JSON file describing the target version and plugins")
+	c.compatVersion = c.flagSets["compat"].String("version", "", "target SuperCollider version, overrides the profile")
+	c.envelopesOutput = c.flagSets["envelopes"].String("output", "text", "output format (text or json)")
+	c.envelopesParams = assignments{}
+	c.flagSets["envelopes"].Var(c.envelopesParams, "set", "param value used to resolve the envelope, e.g. atk=0.1 (repeatable)")
+	c.envelopesPlot = c.flagSets["envelopes"].Bool("plot", false, "add an ASCII plot of each envelope to the text output")
+	c.envelopesSVG = c.flagSets["envelopes"].String("svg", "", "SVG file to plot the envelopes to")
+	c.hashIgnoreName = c.flagSets["hash"].Bool("ignore-name", false, "leave the synthdef name out of the hash")
+	c.lifetimeOutput = c.flagSets["lifetime"].String("output", "text", "output format (text or json)")
+	c.lifetimeStrict = c.flagSets["lifetime"].Bool("strict", false, "fail if any synthdef never frees its synth")
+	c.lintConfig = c.flagSets["lint"].String("config", "", "JSON file that switches rules on and off and suppresses them per synthdef")
+	c.lintFix = c.flagSets["lint"].Bool("fix", false, "fix the issues that can be fixed and rewrite the synthdef files")
+	c.lintList = c.flagSets["lint"].Bool("list", false, "list the lint rules")
+	c.lintOutput = c.flagSets["lint"].String("output", "text", "output format (text or json)")
+	c.paramsOutput = c.flagSets["params"].String("output", "text", "output format (text or json)")
+	c.paramsStrict = c.flagSets["params"].Bool("strict", false, "fail if any param is unused")
+	c.playAddr = c.flagSets["play"].String("addr", defaultScsynthAddr, "address of scsynth")
+	c.playDuration = c.flagSets["play"].Duration("dur", 0, "how long to play before releasing the synth (default until it frees itself)")
+	c.playNode = c.flagSets["play"].Int("id", 1000, "node ID of the synth")
+	c.playParams = assignments{}
+	c.flagSets["play"].Var(c.playParams, "set", "param value, e.g. freq=220 (repeatable)")
+	c.playTCP = c.flagSets["play"].Bool("tcp", false, "connect to scsynth over TCP")
+	c.playTimeout = c.flagSets["play"].Duration("timeout", defaultScsynthTimeout, "how long to wait for scsynth to reply")
+	c.queryOutput = c.flagSets["query"].String("output", "text", "output format (text or json)")
+	c.diffAudio = c.flagSets["diff"].Bool("audio", false, "compare the rendered audio of the synthdefs instead of their structure")
+	c.diffBlockSize = c.flagSets["diff"].Int("block", 64, "block size of the -audio renders")
+	c.diffChannels = c.flagSets["diff"].Int("channels", 2, "number of output channels of the -audio renders, starting at bus 0")
+	c.diffDuration = c.flagSets["diff"].Float64("dur", 1, "duration in seconds of the -audio renders")
+	c.diffOutput = c.flagSets["diff"].String("output", "text", "output format of -audio (text or json)")
+	c.diffParams = assignments{}
+	c.flagSets["diff"].Var(c.diffParams, "set", "param value of both -audio renders, e.g. freq=220 (repeatable)")
+	c.diffRelease = c.flagSets["diff"].Float64("release", -1, "time in seconds at which to set the gate param to 0, or -1 for never")
+	c.diffSampleRate = c.flagSets["diff"].Float64("sr", 48000, "sample rate of the -audio renders")
+	c.diffSeed = c.flagSets["diff"].Int64("seed", 0, "random seed for noise ugens in both -audio renders")
+	c.diffTolerance = c.flagSets["diff"].Float64("tolerance", 1e-4, "largest absolute sample difference for which -audio passes")
+	c.renderBits = c.flagSets["render"].Int("bits", 32, "bits per sample (16 or 24 for PCM, 32 for float)")
+	c.renderBlockSize = c.flagSets["render"].Int("block", 64, "block size")
+	c.renderChannels = c.flagSets["render"].Int("channels", 2, "number of output channels, starting at bus 0")
+	c.renderDuration = c.flagSets["render"].Float64("dur", 1, "duration in seconds")
+	c.renderOut = c.flagSets["render"].String("out", "", "WAV file to write")
+	c.renderParams = assignments{}
+	c.flagSets["render"].Var(c.renderParams, "set", "param value, e.g. freq=220 (repeatable)")
+	c.renderRelease = c.flagSets["render"].Float64("release", -1, "time in seconds at which to set the gate param to 0, or -1 for never")
+	c.renderSampleRate = c.flagSets["render"].Float64("sr", 48000, "sample rate")
+	c.renderSeed = c.flagSets["render"].Int64("seed", 0, "random seed for noise ugens")
+	c.resourcesBlockSize = c.flagSets["resources"].Int("block", 64, "block size (scsynth -z)")
+	c.resourcesInstances = c.flagSets["resources"].Int("instances", 1, "number of synths running at the same time")
+	c.resourcesOutput = c.flagSets["resources"].String("output", "text", "output format (text or json)")
+	c.resourcesRTMemory = c.flagSets["resources"].Int("m", 8192, "real-time memory in KB (scsynth -m)")
+	c.resourcesSampleRate = c.flagSets["resources"].Float64("sr", 48000, "sample rate")
+	c.resourcesWireBufs = c.flagSets["resources"].Int("w", 64, "number of wire buffers (scsynth -w)")
+	c.routingHWInputs = c.flagSets["routing"].Int("hw-inputs", 8, "number of hardware input buses")
+	c.routingHWOutputs = c.flagSets["routing"].Int("hw-outputs", 8, "number of hardware output buses")
+	c.routingOutput = c.flagSets["routing"].String("output", "dot", "output format (dot or json)")
+	c.routingParams = c.flagSets["routing"].String("params", "", "JSON file of synth instances and their param assignments")
+	c.similarOutput = c.flagSets["similar"].String("output", "text", "output format (text or json)")
+	c.similarThreshold = c.flagSets["similar"].Float64("threshold", 0.6, "minimum similarity score (0 to 1) of near-duplicates")
+	c.midi2scoreEnd = c.flagSets["midi2score"].Float64("end", 0, "time in seconds at which the score ends (default the last command)")
+	c.midi2scoreFormat = c.flagSets["midi2score"].String("format", "score", "output format (score for an NRT score, or json for a stream of OSC events)")
+	c.midi2scoreMap = c.flagSets["midi2score"].String("map", "", "JSON file that maps notes, velocity, and controllers onto params")
+	c.midi2scoreOut = c.flagSets["midi2score"].String("out", "", "file to write to (default stdout)")
+	c.scoreDumpOutput = c.flagSets["score-dump"].String("output", "text", "output format (text or json)")
+	c.scoreEnd = c.flagSets["score"].Float64("end", 0, "time in seconds at which the score ends (default the last command)")
+	c.scoreEvents = c.flagSets["score"].String("events", "", "JSON or CSV file of events (time, synthdef, duration, and params)")
+	c.scoreOut = c.flagSets["score"].String("out", "", "file to write the NRT score to (default stdout)")
+	c.sendAddr = c.flagSets["send"].String("addr", defaultScsynthAddr, "UDP address of scsynth")
+	c.sendLoadDir = c.flagSets["send"].String("load-dir", "", "directory shared with scsynth where synthdefs too big for UDP are written and loaded with /d_load")
+	c.sendOutput = c.flagSets["send"].String("output", "text", "output format (text or json)")
+	c.sendServerDir = c.flagSets["send"].String("server-dir", "", "path of -load-dir on the scsynth host (default -load-dir)")
+	c.sendTCP = c.flagSets["send"].Bool("tcp", false, "connect to scsynth over TCP, which has no limit on synthdef size")
+	c.sendTimeout = c.flagSets["send"].Duration("timeout", defaultScsynthTimeout, "how long to wait for scsynth to reply to each synthdef")
+	c.testOutput = c.flagSets["test"].String("output", "text", "output format (text, json, or junit)")
+	c.testUpdate = c.flagSets["test"].Bool("update", false, "write the golden files from the renders instead of comparing them")
+	c.watchAddr = c.flagSets["watch"].String("addr", defaultScsynthAddr, "address of scsynth")
+	c.watchDebounce = c.flagSets["watch"].Duration("debounce", 300*time.Millisecond, "how long a file must stay unchanged before it is sent")
+	c.watchDuration = c.flagSets["watch"].Duration("dur", 0, "how long -play test synths play before they are released (default until the next change)")
+	c.watchInterval = c.flagSets["watch"].Duration("interval", 250*time.Millisecond, "how often to poll the directory")
+	c.watchLoadDir = c.flagSets["watch"].String("load-dir", "", "directory shared with scsynth where synthdefs too big for UDP are written and loaded with /d_load")
+	c.watchNode = c.flagSets["watch"].Int("id", 1000, "node ID of the first -play test synth")
+	c.watchParams = assignments{}
+	c.flagSets["watch"].Var(c.watchParams, "set", "param value of the -play test synths that have the param, e.g. freq=220 (repeatable)")
+	c.watchPlay = c.flagSets["watch"].Bool("play", false, "start a test synth after every send, releasing the previous one")
+	c.watchServerDir = c.flagSets["watch"].String("server-dir", "", "path of -load-dir on the scsynth host (default -load-dir)")
+	c.watchTCP = c.flagSets["watch"].Bool("tcp", false, "connect to scsynth over TCP")
+	c.watchTimeout = c.flagSets["watch"].Duration("timeout", defaultScsynthTimeout, "how long to wait for scsynth to reply")
 	return c
 }
 
@@ -68,6 +307,9 @@ func (c *controller) diff() error {
 	if expected, got := 2, len(fset.Args()); expected != got {
 		return errors.Errorf("expected %d args, got %d", expected, got)
 	}
+	if *c.diffAudio {
+		return c.audioDiff()
+	}
 	f1, err := os.Open(fset.Arg(0))
 	if err != nil {
 		return err
@@ -105,31 +347,88 @@ func (c *controller) format() error {
 	if err != nil {
 		return err
 	}
+	cat, err := c.loadCatalog()
+	if err != nil {
+		return err
+	}
 	switch *c.output {
 	// case "dot":
 	// 	return d.WriteGraph(os.Stdout)
 	case "json":
-		return d.WriteJSON(os.Stdout)
+		return json.NewEncoder(os.Stdout).Encode(newFormattedSynthdef(d, cat))
 	case "xml":
-		return d.WriteXML(os.Stdout)
+		return xml.NewEncoder(os.Stdout).Encode(newFormattedSynthdef(d, cat))
 	case "tree":
 		fallthrough
 	default:
-		return c.writeTree(os.Stdout, d)
+		return c.writeTree(os.Stdout, d, cat)
 	}
 }
 
 // run runs a command
 func (c *controller) run() error {
 	switch c.command {
+	case "buffers":
+		return c.buffers()
+	case "buses":
+		return c.buses()
+	case "canonicalize":
+		return c.canonicalizeCmd()
+	case "catalog":
+		return c.catalog()
+	case "check-order":
+		return c.checkOrder()
+	case "compat":
+		return c.compat()
+	case "envelopes":
+		return c.envelopes()
 	case "format":
 		return c.format()
 	case "diff":
 		return c.diff()
+	case "hash":
+		return c.hash()
+	case "lifetime":
+		return c.lifetime()
+	case "lint":
+		return c.lint()
+	case "params":
+		return c.params()
+	case "play":
+		return c.play()
+	case "query":
+		return c.query()
+	case "render":
+		return c.render()
+	case "resources":
+		return c.resources()
+	case "routing":
+		return c.routing()
+	case "midi2score":
+		return c.midi2score()
+	case "score":
+		return c.score()
+	case "score-dump":
+		return c.scoreDump()
+	case "send":
+		return c.send()
+	case "similar":
+		return c.similar()
+	case "test":
+		return c.testCmd()
+	case "watch":
+		return c.watch()
 	}
 	return nil
 }
 
+// writeJSON writes a value as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
 // usage prints a usage message on stderr
 func (c *controller) usage() {
 	w, prog := os.Stderr, os.Args[0]
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of MIDI events that midi2score uses.
+const (
+	midiNoteOff = iota
+	midiNoteOn
+	midiControlChange
+)
+
+// midiDefaultTempo is the tempo in microseconds per quarter note until the first tempo event.
+const midiDefaultTempo = 500000
+
+// midiEvent is a channel event of a Standard MIDI File.
+type midiEvent struct {
+	Tick    uint64
+	Track   int
+	Kind    int
+	Channel int // 1 to 16
+	Data1   int // note or controller number
+	Data2   int // velocity or controller value
+}
+
+// midiTempo is a tempo change of a Standard MIDI File.
+type midiTempo struct {
+	Tick                uint64
+	MicrosPerQuarter    uint32
+	secondsBeforeChange float64
+}
+
+// midiFile is a parsed Standard MIDI File.
+type midiFile struct {
+	Format   int
+	Tracks   int
+	Division int16
+
+	// Events are note and control change events of every track, ordered by tick.
+	Events []midiEvent
+	Tempos []midiTempo
+}
+
+// readMIDIFile reads a format 0 or 1 Standard MIDI File.
+func readMIDIFile(path string) (*midiFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	mf, err := readMIDI(bufio.NewReader(f))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading "+path)
+	}
+	return mf, nil
+}
+
+// readMIDI reads a format 0 or 1 Standard MIDI File.
+func readMIDI(r io.Reader) (*midiFile, error) {
+	id, header, err := readMIDIChunk(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != "MThd" || len(header) < 6 {
+		return nil, errors.New("not a Standard MIDI File")
+	}
+	mf := &midiFile{
+		Format:   int(binary.BigEndian.Uint16(header)),
+		Tracks:   int(binary.BigEndian.Uint16(header[2:])),
+		Division: int16(binary.BigEndian.Uint16(header[4:])),
+	}
+	if mf.Format > 1 {
+		return nil, errors.Errorf("unsupported MIDI file format %d, expected 0 or 1", mf.Format)
+	}
+	if mf.Division == 0 {
+		return nil, errors.New("MIDI file has a division of 0")
+	}
+	for track := 0; track < mf.Tracks; {
+		id, data, err := readMIDIChunk(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading track %d", track)
+		}
+		if id != "MTrk" {
+			continue // Unknown chunks are skipped.
+		}
+		if err := mf.parseTrack(track, data); err != nil {
+			return nil, errors.Wrapf(err, "track %d", track)
+		}
+		track++
+	}
+	sort.SliceStable(mf.Events, func(i, j int) bool { return mf.Events[i].Tick < mf.Events[j].Tick })
+	sort.SliceStable(mf.Tempos, func(i, j int) bool { return mf.Tempos[i].Tick < mf.Tempos[j].Tick })
+	mf.indexTempos()
+	return mf, nil
+}
+
+// readMIDIChunk reads the ID and data of a chunk.
+func readMIDIChunk(r io.Reader) (string, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[4:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", nil, err
+	}
+	return string(header[:4]), data, nil
+}
+
+// parseTrack parses the events of a track chunk.
+func (mf *midiFile) parseTrack(track int, data []byte) error {
+	var (
+		pos     int
+		tick    uint64
+		running byte
+	)
+	readVarLen := func() (uint64, error) {
+		var v uint64
+		for i := 0; i < 4; i++ {
+			if pos >= len(data) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := data[pos]
+			pos++
+			v = v<<7 | uint64(b&0x7F)
+			if b&0x80 == 0 {
+				return v, nil
+			}
+		}
+		return 0, errors.New("variable-length quantity is longer than 4 bytes")
+	}
+	skip := func(n uint64) error {
+		if uint64(len(data)-pos) < n {
+			return io.ErrUnexpectedEOF
+		}
+		pos += int(n)
+		return nil
+	}
+	for pos < len(data) {
+		delta, err := readVarLen()
+		if err != nil {
+			return err
+		}
+		tick += delta
+
+		if pos >= len(data) {
+			return io.ErrUnexpectedEOF
+		}
+		status := data[pos]
+		switch {
+		case status == 0xFF:
+			if pos+2 > len(data) {
+				return io.ErrUnexpectedEOF
+			}
+			kind := data[pos+1]
+			pos += 2
+			n, err := readVarLen()
+			if err != nil {
+				return err
+			}
+			start := pos
+			if err := skip(n); err != nil {
+				return err
+			}
+			switch {
+			case kind == 0x2F:
+				return nil // End of track.
+			case kind == 0x51 && n == 3:
+				b := data[start:]
+				mf.Tempos = append(mf.Tempos, midiTempo{
+					Tick:             tick,
+					MicrosPerQuarter: uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]),
+				})
+			}
+			continue
+		case status == 0xF0 || status == 0xF7:
+			pos++
+			n, err := readVarLen()
+			if err != nil {
+				return err
+			}
+			if err := skip(n); err != nil {
+				return err
+			}
+			continue
+		case status&0x80 != 0:
+			running = status
+			pos++
+		case running == 0:
+			return errors.Errorf("data byte 0x%02x without a status byte", status)
+		}
+		length := 2
+		if kind := running & 0xF0; kind == 0xC0 || kind == 0xD0 {
+			length = 1
+		}
+		if pos+length > len(data) {
+			return io.ErrUnexpectedEOF
+		}
+		ev := midiEvent{Tick: tick, Track: track, Channel: int(running&0x0F) + 1, Data1: int(data[pos])}
+		if length == 2 {
+			ev.Data2 = int(data[pos+1])
+		}
+		pos += length
+
+		switch running & 0xF0 {
+		case 0x80:
+			ev.Kind = midiNoteOff
+		case 0x90:
+			ev.Kind = midiNoteOn
+			if ev.Data2 == 0 {
+				ev.Kind = midiNoteOff
+			}
+		case 0xB0:
+			ev.Kind = midiControlChange
+		default:
+			continue
+		}
+		mf.Events = append(mf.Events, ev)
+	}
+	return nil
+}
+
+// indexTempos computes the time in seconds of every tempo change.
+func (mf *midiFile) indexTempos() {
+	var (
+		seconds float64
+		last    = midiTempo{MicrosPerQuarter: midiDefaultTempo}
+	)
+	for i := range mf.Tempos {
+		seconds += mf.tickSeconds(mf.Tempos[i].Tick-last.Tick, last.MicrosPerQuarter)
+		mf.Tempos[i].secondsBeforeChange = seconds
+		last = mf.Tempos[i]
+	}
+}
+
+// tickSeconds converts a number of ticks at a tempo to seconds.
+// SMPTE divisions are in ticks per second and ignore the tempo.
+func (mf *midiFile) tickSeconds(ticks uint64, microsPerQuarter uint32) float64 {
+	if mf.Division < 0 {
+		fps := -float64(int8(mf.Division >> 8))
+		if fps == 29 {
+			fps = 29.97
+		}
+		return float64(ticks) / (fps * float64(mf.Division&0xFF))
+	}
+	return float64(ticks) * float64(microsPerQuarter) / 1e6 / float64(mf.Division)
+}
+
+// seconds converts a tick to seconds from the start of the file using the tempo map.
+func (mf *midiFile) seconds(tick uint64) float64 {
+	i := sort.Search(len(mf.Tempos), func(i int) bool { return mf.Tempos[i].Tick > tick })
+	if i == 0 {
+		return mf.tickSeconds(tick, midiDefaultTempo)
+	}
+	t := mf.Tempos[i-1]
+	return t.secondsBeforeChange + mf.tickSeconds(tick-t.Tick, t.MicrosPerQuarter)
+}
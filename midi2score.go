@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// midiMapping maps MIDI notes and controllers onto the params of a synthdef.
+type midiMapping struct {
+	// Synthdef is the name of the synthdef that plays the notes.
+	// It can be omitted if midi2score is given a single synthdef.
+	Synthdef string `json:"synthdef"`
+
+	Note     midiNoteMapping   `json:"note"`
+	Velocity *midiRangeMapping `json:"velocity"`
+
+	// CC maps controller numbers to params.
+	CC map[string]midiRangeMapping `json:"cc"`
+
+	// Channels are the MIDI channels from 1 to 16 to play, or empty for every channel.
+	Channels []int `json:"channels"`
+
+	// Params are set on every synth.
+	Params map[string]float32 `json:"params"`
+}
+
+// midiNoteMapping maps note numbers onto a param.
+type midiNoteMapping struct {
+	Param     string  `json:"param"`
+	MIDICPS   bool    `json:"midicps"`
+	Transpose float64 `json:"transpose"`
+}
+
+// midiRangeMapping maps MIDI values from 0 to 127 linearly onto a param.
+// If Min and Max are equal, the range is 0 to 1.
+type midiRangeMapping struct {
+	Param string  `json:"param"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// value maps a MIDI value onto the range.
+func (m midiRangeMapping) value(v int) float32 {
+	lo, hi := m.Min, m.Max
+	if lo == hi {
+		lo, hi = 0, 1
+	}
+	return float32(lo + (hi-lo)*float64(v)/127)
+}
+
+// value maps a note number onto the note param.
+func (m midiNoteMapping) value(note int) float32 {
+	n := float64(note) + m.Transpose
+	if m.MIDICPS {
+		return float32(440 * math.Pow(2, (n-69)/12))
+	}
+	return float32(n)
+}
+
+// readMIDIMapping reads a MIDI mapping from a JSON file.
+func readMIDIMapping(path string) (*midiMapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	m := &midiMapping{}
+	if err := json.NewDecoder(f).Decode(m); err != nil {
+		return nil, errors.Wrap(err, "decoding "+path)
+	}
+	return m, nil
+}
+
+// defaultMIDIMapping maps notes to freq with midicps, or to note, and velocity to amp,
+// if the synthdef has those params.
+func defaultMIDIMapping(def *sc.Synthdef) *midiMapping {
+	m := &midiMapping{Synthdef: def.Name}
+	switch {
+	case hasParam(def, "freq"):
+		m.Note = midiNoteMapping{Param: "freq", MIDICPS: true}
+	case hasParam(def, "note"):
+		m.Note = midiNoteMapping{Param: "note"}
+	}
+	if hasParam(def, "amp") {
+		m.Velocity = &midiRangeMapping{Param: "amp"}
+	}
+	return m
+}
+
+// check checks that every param of the mapping is a param of the synthdef
+// and returns the controllers that the mapping uses.
+func (m *midiMapping) check(def *sc.Synthdef) (map[int]midiRangeMapping, error) {
+	if m.Note.Param == "" {
+		return nil, errors.Errorf("no note param for %s, expected a freq or note param or a mapping", def.Name)
+	}
+	params := map[string]float32{m.Note.Param: 0}
+	for name := range m.Params {
+		params[name] = 0
+	}
+	if m.Velocity != nil {
+		params[m.Velocity.Param] = 0
+	}
+	controllers := map[int]midiRangeMapping{}
+	for cc, cm := range m.CC {
+		n, err := strconv.Atoi(cc)
+		if err != nil || n < 0 || n > 127 {
+			return nil, errors.Errorf("controller %q is not a number from 0 to 127", cc)
+		}
+		controllers[n] = cm
+		params[cm.Param] = 0
+	}
+	for _, ch := range m.Channels {
+		if ch < 1 || ch > 16 {
+			return nil, errors.Errorf("channel %d is not from 1 to 16", ch)
+		}
+	}
+	return controllers, checkParams(def, params)
+}
+
+// midiVoice is a sounding note.
+type midiVoice struct {
+	Channel int
+	Note    int
+	Node    int32
+}
+
+// midiScore adds the notes and controllers of a MIDI file to a score.
+// Every note starts a synth, note off releases it, and a control change sets
+// its param on the sounding synths of the channel and on later synths.
+// Notes that are still on at the end of the file are released there.
+func midiScore(b *scoreBuilder, mf *midiFile, m *midiMapping, controllers map[int]midiRangeMapping) error {
+	var (
+		channels = map[int]bool{}
+		voices   = []midiVoice{}
+		ccValues = map[int]map[string]float32{}
+		end      float64
+	)
+	for _, ch := range m.Channels {
+		channels[ch] = true
+	}
+	for _, ev := range mf.Events {
+		if len(channels) > 0 && !channels[ev.Channel] {
+			continue
+		}
+		seconds := mf.seconds(ev.Tick)
+		end = math.Max(end, seconds)
+
+		switch ev.Kind {
+		case midiNoteOn:
+			params := map[string]float32{}
+			for name, v := range m.Params {
+				params[name] = v
+			}
+			for name, v := range ccValues[ev.Channel] {
+				params[name] = v
+			}
+			params[m.Note.Param] = m.Note.value(ev.Data1)
+			if m.Velocity != nil {
+				params[m.Velocity.Param] = m.Velocity.value(ev.Data2)
+			}
+			id, err := b.synth(seconds, m.Synthdef, params)
+			if err != nil {
+				return err
+			}
+			voices = append(voices, midiVoice{Channel: ev.Channel, Note: ev.Data1, Node: id})
+		case midiNoteOff:
+			// The oldest voice of the note is released first.
+			for i, v := range voices {
+				if v.Channel == ev.Channel && v.Note == ev.Data1 {
+					b.release(seconds, v.Node, m.Synthdef)
+					voices = append(voices[:i], voices[i+1:]...)
+					break
+				}
+			}
+		case midiControlChange:
+			cm, ok := controllers[ev.Data1]
+			if !ok {
+				continue
+			}
+			if ccValues[ev.Channel] == nil {
+				ccValues[ev.Channel] = map[string]float32{}
+			}
+			value := cm.value(ev.Data2)
+			ccValues[ev.Channel][cm.Param] = value
+			for _, v := range voices {
+				if v.Channel == ev.Channel {
+					b.set(seconds, v.Node, map[string]float32{cm.Param: value})
+				}
+			}
+		}
+	}
+	for _, v := range voices {
+		b.release(end, v.Node, m.Synthdef)
+	}
+	return nil
+}
+
+// midi2score runs the midi2score command
+func (c *controller) midi2score() error {
+	fset := c.flagSets["midi2score"]
+
+	if fset.NArg() < 2 {
+		return errors.New("expected a MIDI file and at least one synthdef file or directory")
+	}
+	entries := []libraryEntry{}
+	for _, path := range fset.Args()[1:] {
+		more, err := readSynthdefPath(path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, more...)
+	}
+	b, err := newScoreBuilder(entries)
+	if err != nil {
+		return err
+	}
+	var m *midiMapping
+	if *c.midi2scoreMap != "" {
+		if m, err = readMIDIMapping(*c.midi2scoreMap); err != nil {
+			return err
+		}
+	}
+	switch {
+	case m != nil && m.Synthdef != "":
+	case len(b.defs) == 1 && m != nil:
+		m.Synthdef = b.defs[0].Name
+	case len(b.defs) == 1:
+		m = defaultMIDIMapping(b.defs[0])
+	default:
+		return errors.New("expected a mapping with a synthdef name when there are several synthdefs")
+	}
+	def, ok := b.byName[m.Synthdef]
+	if !ok {
+		return errors.Errorf("unknown synthdef %s", m.Synthdef)
+	}
+	controllers, err := m.check(def)
+	if err != nil {
+		return err
+	}
+	mf, err := readMIDIFile(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := midiScore(b, mf, m, controllers); err != nil {
+		return err
+	}
+	bundles, err := b.bundles(*c.midi2scoreEnd)
+	if err != nil {
+		return err
+	}
+	switch *c.midi2scoreFormat {
+	case "json":
+		return c.writeMIDIEvents(scoreEntries(bundles))
+	case "score":
+		if *c.midi2scoreOut == "" {
+			return writeScore(os.Stdout, bundles)
+		}
+		return writeScoreFile(*c.midi2scoreOut, bundles)
+	default:
+		return errors.Errorf("unsupported format %q", *c.midi2scoreFormat)
+	}
+}
+
+// writeMIDIEvents writes the commands of a score as a JSON stream of OSC events.
+func (c *controller) writeMIDIEvents(entries []scoreEntry) error {
+	if *c.midi2scoreOut == "" {
+		return writeJSON(os.Stdout, entries)
+	}
+	f, err := os.Create(*c.midi2scoreOut)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(f, entries); err != nil {
+		_ = f.Close() // Best effort.
+		return errors.Wrap(err, "writing "+*c.midi2scoreOut)
+	}
+	return f.Close()
+}
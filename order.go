@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// addActions maps the names of the /s_new and /g_new add actions to their values.
+var addActions = map[string]int32{
+	"addToHead":  sc.AddToHead,
+	"addToTail":  sc.AddToTail,
+	"addBefore":  sc.AddBefore,
+	"addAfter":   sc.AddAfter,
+	"addReplace": sc.AddReplace,
+}
+
+// addAction is an add action that can be decoded from either its name or its number.
+type addAction int32
+
+// UnmarshalJSON decodes an add action.
+func (a *addAction) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		v, ok := addActions[name]
+		if !ok {
+			return errors.Errorf("unknown add action %q", name)
+		}
+		*a = addAction(v)
+		return nil
+	}
+	var v int32
+	if err := json.Unmarshal(data, &v); err != nil {
+		return errors.Wrap(err, "decoding add action")
+	}
+	if v < sc.AddToHead || v > sc.AddReplace {
+		return errors.Errorf("unknown add action %d", v)
+	}
+	*a = addAction(v)
+	return nil
+}
+
+// nodeSpec describes the creation of a group or a synth in a node tree file.
+type nodeSpec struct {
+	ID       int32              `json:"id"`
+	Group    bool               `json:"group,omitempty"`
+	Synthdef string             `json:"synthdef,omitempty"`
+	Action   addAction          `json:"action"`
+	Target   int32              `json:"target"`
+	Params   map[string]float32 `json:"params,omitempty"`
+}
+
+// nodeTreeSpec is the contents of a node tree file.
+// Nodes are added to the tree in the order they appear in the file,
+// just like scsynth would process a sequence of /g_new and /s_new commands.
+type nodeTreeSpec struct {
+	Nodes []nodeSpec `json:"nodes"`
+}
+
+// orderNode is a node in a node tree.
+type orderNode struct {
+	nodeSpec
+
+	parent   *orderNode
+	children []*orderNode
+}
+
+// nodeTree simulates the node tree of scsynth.
+type nodeTree struct {
+	root  *orderNode
+	nodes map[int32]*orderNode
+}
+
+// newNodeTree creates a node tree that contains the root node
+// and the default group, like the one sclang creates when it boots a server.
+func newNodeTree() *nodeTree {
+	root := &orderNode{nodeSpec: nodeSpec{ID: sc.RootNodeID, Group: true}}
+	t := &nodeTree{
+		root:  root,
+		nodes: map[int32]*orderNode{sc.RootNodeID: root},
+	}
+	_ = t.add(nodeSpec{ID: sc.DefaultGroupID, Group: true, Action: addAction(sc.AddToTail), Target: sc.RootNodeID})
+	return t
+}
+
+// add adds a node to the tree.
+func (t *nodeTree) add(spec nodeSpec) error {
+	if _, exists := t.nodes[spec.ID]; exists {
+		return errors.Errorf("duplicate node ID %d", spec.ID)
+	}
+	target, ok := t.nodes[spec.Target]
+	if !ok {
+		return errors.Errorf("node %d: target %d not found", spec.ID, spec.Target)
+	}
+	n := &orderNode{nodeSpec: spec}
+
+	switch int32(spec.Action) {
+	case sc.AddToHead, sc.AddToTail:
+		if !target.Group {
+			return errors.Errorf("node %d: target %d is not a group", spec.ID, spec.Target)
+		}
+		n.parent = target
+		if int32(spec.Action) == sc.AddToHead {
+			target.children = append([]*orderNode{n}, target.children...)
+		} else {
+			target.children = append(target.children, n)
+		}
+	case sc.AddBefore, sc.AddAfter, sc.AddReplace:
+		if target.parent == nil {
+			return errors.Errorf("node %d: can not add relative to the root node", spec.ID)
+		}
+		n.parent = target.parent
+		siblings, i := target.parent.children, target.index()
+
+		switch int32(spec.Action) {
+		case sc.AddBefore:
+			siblings = append(siblings[:i], append([]*orderNode{n}, siblings[i:]...)...)
+		case sc.AddAfter:
+			siblings = append(siblings[:i+1], append([]*orderNode{n}, siblings[i+1:]...)...)
+		case sc.AddReplace:
+			siblings[i] = n
+			t.remove(target)
+		}
+		target.parent.children = siblings
+	}
+	t.nodes[spec.ID] = n
+	return nil
+}
+
+// remove removes a node and all of its descendants from the node index.
+func (t *nodeTree) remove(n *orderNode) {
+	delete(t.nodes, n.ID)
+	for _, child := range n.children {
+		t.remove(child)
+	}
+}
+
+// index returns the position of a node within its parent.
+func (n *orderNode) index() int {
+	for i, sibling := range n.parent.children {
+		if sibling == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// synths returns the synth nodes in the order scsynth executes them.
+func (t *nodeTree) synths() []*orderNode {
+	var (
+		synths []*orderNode
+		walk   func(n *orderNode)
+	)
+	walk = func(n *orderNode) {
+		if !n.Group {
+			synths = append(synths, n)
+			return
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(t.root)
+	return synths
+}
+
+// String returns a short description of a node.
+func (n *orderNode) String() string {
+	return fmt.Sprintf("%d (%s)", n.ID, n.Synthdef)
+}
+
+// orderProblem is a synth that reads a bus before another synth writes to it.
+type orderProblem struct {
+	Reader *orderNode
+	Writer *orderNode
+	Bus    busKey
+}
+
+// orderCheck is the result of checking the order of the synths in a node tree.
+type orderCheck struct {
+	Order     []*orderNode
+	Problems  []orderProblem
+	Suggested []*orderNode
+	Cycle     bool
+}
+
+// findOrderProblems finds the synths that read a bus before it is written
+// and suggests an execution order where every writer runs before its readers.
+// InFeedback reads are ignored since they intentionally read the previous block.
+func findOrderProblems(lib []libraryEntry, synths []*orderNode) (*orderCheck, error) {
+	var (
+		check   = &orderCheck{Order: synths}
+		writers = map[busKey][]int{}
+		readers = map[busKey][]int{}
+	)
+	for i, n := range synths {
+		def, ok := findSynthdef(lib, n.Synthdef)
+		if !ok {
+			return nil, errors.Errorf("node %d: synthdef %s not found", n.ID, n.Synthdef)
+		}
+		for _, ba := range busAccesses(def) {
+			if ba.Local || ba.Bus == nil || ba.Ugen == "InFeedback" {
+				continue
+			}
+			first, ok := resolveInput(def, *ba.Bus, n.Params)
+			if !ok {
+				continue
+			}
+			for ch := 0; ch < ba.Channels; ch++ {
+				key := busKey{Rate: ba.Rate, Index: int(first) + ch}
+				if ba.Direction == busWrite {
+					writers[key] = appendUnique(writers[key], i)
+				} else {
+					readers[key] = appendUnique(readers[key], i)
+				}
+			}
+		}
+	}
+	// deps[i] contains the synths that have to run before synth i.
+	deps := make([][]int, len(synths))
+
+	for key, rs := range readers {
+		for _, r := range rs {
+			for _, w := range writers[key] {
+				if w == r {
+					continue
+				}
+				deps[r] = appendUnique(deps[r], w)
+				if w > r {
+					check.Problems = append(check.Problems, orderProblem{Reader: synths[r], Writer: synths[w], Bus: key})
+				}
+			}
+		}
+	}
+	sort.Slice(check.Problems, func(i, j int) bool {
+		a, b := check.Problems[i], check.Problems[j]
+		if a.Reader.ID != b.Reader.ID {
+			return a.Reader.ID < b.Reader.ID
+		}
+		if a.Writer.ID != b.Writer.ID {
+			return a.Writer.ID < b.Writer.ID
+		}
+		if a.Bus.Rate != b.Bus.Rate {
+			return a.Bus.Rate < b.Bus.Rate
+		}
+		return a.Bus.Index < b.Bus.Index
+	})
+	check.Suggested, check.Cycle = stableTopsort(synths, deps)
+	return check, nil
+}
+
+// stableTopsort orders synths so that each one comes after its dependencies,
+// keeping the original order wherever possible.
+// The second return value is true if the dependencies contain a cycle.
+func stableTopsort(synths []*orderNode, deps [][]int) ([]*orderNode, bool) {
+	var (
+		placed = make([]bool, len(synths))
+		order  = []*orderNode{}
+	)
+	for len(order) < len(synths) {
+		next := -1
+		for i := range synths {
+			if placed[i] {
+				continue
+			}
+			ready := true
+			for _, d := range deps[i] {
+				if !placed[d] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			return nil, true
+		}
+		placed[next] = true
+		order = append(order, synths[next])
+	}
+	return order, false
+}
+
+// appendUnique appends an int to a slice if it is not already in the slice.
+func appendUnique(a []int, v int) []int {
+	for _, x := range a {
+		if x == v {
+			return a
+		}
+	}
+	return append(a, v)
+}
+
+// write writes a human-readable report of the order check.
+func (check *orderCheck) write(w io.Writer) {
+	fmt.Fprintf(w, "execution order:\n")
+	for i, n := range check.Order {
+		fmt.Fprintf(w, "  %d. %s in group %d\n", i+1, n, n.parent.ID)
+	}
+	if len(check.Problems) == 0 {
+		fmt.Fprintf(w, "no ordering problems\n")
+		return
+	}
+	fmt.Fprintf(w, "problems:\n")
+	for _, p := range check.Problems {
+		fmt.Fprintf(w, "  %s reads %s bus %d before %s writes it\n", p.Reader, p.Bus.Rate, p.Bus.Index, p.Writer)
+	}
+	if check.Cycle {
+		fmt.Fprintf(w, "the bus dependencies contain a cycle, use InFeedback to break it\n")
+		return
+	}
+	names := make([]string, len(check.Suggested))
+	for i, n := range check.Suggested {
+		names[i] = n.String()
+	}
+	fmt.Fprintf(w, "suggested order: %s\n", strings.Join(names, ", "))
+	fmt.Fprintf(w, "suggested moves:\n")
+
+	// Move each misplaced reader after the last writer it depends on.
+	moved := map[int32]bool{}
+	for _, p := range check.Problems {
+		if moved[p.Reader.ID] {
+			continue
+		}
+		moved[p.Reader.ID] = true
+		fmt.Fprintf(w, "  /n_after %d %d\n", p.Reader.ID, check.lastWriter(p.Reader).ID)
+	}
+}
+
+// lastWriter returns the writer of a reader's buses that runs last in the suggested order.
+func (check *orderCheck) lastWriter(reader *orderNode) *orderNode {
+	var last *orderNode
+	for _, p := range check.Problems {
+		if p.Reader != reader {
+			continue
+		}
+		if last == nil || suggestedIndex(check.Suggested, p.Writer) > suggestedIndex(check.Suggested, last) {
+			last = p.Writer
+		}
+	}
+	return last
+}
+
+// suggestedIndex returns the position of a node in an ordering.
+func suggestedIndex(order []*orderNode, n *orderNode) int {
+	for i, m := range order {
+		if m == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkOrder runs the check-order command
+func (c *controller) checkOrder() error {
+	fset := c.flagSets["check-order"]
+
+	if expected, got := 1, fset.NArg(); expected != got {
+		return errors.Errorf("expected %d args, got %d", expected, got)
+	}
+	f, err := os.Open(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	var spec nodeTreeSpec
+	if err := json.NewDecoder(f).Decode(&spec); err != nil {
+		return errors.Wrap(err, "decoding "+fset.Arg(0))
+	}
+	lib, err := readSynthdefDir(*c.checkOrderDir)
+	if err != nil {
+		return err
+	}
+	tree := newNodeTree()
+	for _, node := range spec.Nodes {
+		if !node.Group && node.Synthdef == "" {
+			return errors.Errorf("node %d: synth nodes need a synthdef", node.ID)
+		}
+		if err := tree.add(node); err != nil {
+			return err
+		}
+	}
+	check, err := findOrderProblems(lib, tree.synths())
+	if err != nil {
+		return err
+	}
+	check.write(os.Stdout)
+
+	if n := len(check.Problems); n > 0 {
+		return errors.Errorf("found %d ordering problem(s)", n)
+	}
+	return nil
+}
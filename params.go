@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// paramConsumer is a ugen input that consumes a param.
+type paramConsumer struct {
+	Ugen      string `json:"ugen"`
+	UgenIndex int    `json:"ugenIndex"`
+	Input     int    `json:"input"`
+	InputName string `json:"inputName"`
+	// Offset is the position of the consumed value within an arrayed param.
+	Offset int32 `json:"offset,omitempty"`
+}
+
+// String returns a short description of the consumer.
+func (pc paramConsumer) String() string {
+	return fmt.Sprintf("%s(%d).%s", pc.Ugen, pc.UgenIndex, pc.InputName)
+}
+
+// paramUsage describes a synthdef param and the ugen inputs that consume it.
+type paramUsage struct {
+	Name      string          `json:"name"`
+	Index     int32           `json:"index"`
+	Length    int32           `json:"length"`
+	Defaults  []float32       `json:"defaults"`
+	Control   string          `json:"control"`
+	Consumers []paramConsumer `json:"consumers"`
+	Unused    bool            `json:"unused,omitempty"`
+}
+
+// paramUsages returns every param of a synthdef along with its consumers, ordered by index.
+// Arrayed params, where one name spans several consecutive indices, are returned as one
+// paramUsage whose length is the number of indices.
+func paramUsages(def *sc.Synthdef, cat ugenCatalog) []paramUsage {
+	var (
+		model  = newControlModel(def)
+		slices = paramSlices(def)
+		usages = make([]paramUsage, len(slices))
+	)
+	for i, slice := range slices {
+		usages[i] = paramUsage{
+			Name:      slice.Name,
+			Index:     slice.Index,
+			Length:    slice.Length,
+			Control:   "none",
+			Consumers: []paramConsumer{},
+		}
+		if pc, ok := model.control(slice.Index); ok {
+			usages[i].Control = pc.Control
+		}
+		if end := slice.Index + slice.Length; slice.Index >= 0 && slice.Length >= 0 && int(end) <= len(def.InitialParamValues) {
+			usages[i].Defaults = def.InitialParamValues[slice.Index:end]
+		}
+	}
+	for ui, u := range def.Ugens {
+		for ii, in := range u.Inputs {
+			src := describeInput(def, in)
+			if src.Kind != sourceParam {
+				continue
+			}
+			for i := range usages {
+				usage := &usages[i]
+				if src.ParamIndex < usage.Index || src.ParamIndex >= usage.Index+usage.Length {
+					continue
+				}
+				usage.Consumers = append(usage.Consumers, paramConsumer{
+					Ugen:      u.Name,
+					UgenIndex: ui,
+					Input:     ii,
+					InputName: cat.inputName(u, ii),
+					Offset:    src.ParamIndex - usage.Index,
+				})
+			}
+		}
+	}
+	for i := range usages {
+		usages[i].Unused = len(usages[i].Consumers) == 0
+	}
+	return usages
+}
+
+// synthdefParams is the param report for a single synthdef file.
+type synthdefParams struct {
+	File     string       `json:"file"`
+	Synthdef string       `json:"synthdef"`
+	Params   []paramUsage `json:"params"`
+}
+
+// params runs the params command
+func (c *controller) params() error {
+	fset := c.flagSets["params"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file")
+	}
+	cat, err := c.loadCatalog()
+	if err != nil {
+		return err
+	}
+	var (
+		reports = []synthdefParams{}
+		unused  = 0
+	)
+	for _, path := range fset.Args() {
+		def, err := readSynthdefFile(path)
+		if err != nil {
+			return err
+		}
+		report := synthdefParams{File: path, Synthdef: def.Name, Params: paramUsages(def, cat)}
+		for _, usage := range report.Params {
+			if usage.Unused {
+				unused++
+			}
+		}
+		reports = append(reports, report)
+	}
+	switch *c.paramsOutput {
+	case "json":
+		err = writeJSON(os.Stdout, reports)
+	case "text":
+		err = writeParams(os.Stdout, reports)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.paramsOutput)
+	}
+	if err != nil {
+		return err
+	}
+	if *c.paramsStrict && unused > 0 {
+		return errors.Errorf("found %d unused param(s)", unused)
+	}
+	return nil
+}
+
+// writeParams writes a human-readable param report.
+func writeParams(w io.Writer, reports []synthdefParams) error {
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s (%s)\n", report.File, report.Synthdef)
+		if len(report.Params) == 0 {
+			fmt.Fprintf(w, "  no params\n")
+		}
+		for _, usage := range report.Params {
+			var (
+				name     = usage.Name
+				defaults = make([]string, len(usage.Defaults))
+			)
+			if usage.Length != 1 {
+				name = fmt.Sprintf("%s[%d]", usage.Name, usage.Length)
+			}
+			for i, v := range usage.Defaults {
+				defaults[i] = fmt.Sprintf("%g", v)
+			}
+			fmt.Fprintf(w, "  %3d  %-16s %-12s %-12s", usage.Index, name, strings.Join(defaults, " "), usage.Control)
+			if usage.Unused {
+				fmt.Fprintf(w, " UNUSED\n")
+				continue
+			}
+			consumers := make([]string, len(usage.Consumers))
+			for i, pc := range usage.Consumers {
+				consumers[i] = pc.String()
+				if usage.Length != 1 {
+					consumers[i] = fmt.Sprintf("[%d] -> %s", pc.Offset, consumers[i])
+				}
+			}
+			fmt.Fprintf(w, " %s\n", strings.Join(consumers, ", "))
+		}
+	}
+	return nil
+}
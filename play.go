@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// play runs the play command
+func (c *controller) play() error {
+	fset := c.flagSets["play"]
+
+	if fset.NArg() != 1 {
+		return errors.New("expected one synthdef file")
+	}
+	if *c.playDuration < 0 {
+		return errors.New("-dur must not be negative")
+	}
+	def, err := readSynthdefFile(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	params := map[string]float32(c.playParams)
+	if err := checkParams(def, params); err != nil {
+		return err
+	}
+	network := "udp"
+	if *c.playTCP {
+		network = "tcp"
+	}
+	client, err := dialScsynth(network, *c.playAddr, *c.playTimeout)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.close() }() // Best effort.
+
+	if _, err := client.sendDef(def); err != nil {
+		return errors.Wrap(err, "sending "+def.Name)
+	}
+	id := int32(*c.playNode)
+	if err := client.synth(def.Name, id, params); err != nil {
+		return errors.Wrapf(err, "creating a %s synth", def.Name)
+	}
+	fmt.Fprintf(os.Stdout, "playing %s as node %d\n", def.Name, id)
+
+	if *c.playDuration == 0 {
+		return nil // The synth plays until it frees itself.
+	}
+	time.Sleep(*c.playDuration)
+	return errors.Wrapf(client.release(def, id), "releasing node %d", id)
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// Query combinators.
+const (
+	combinatorNone       = 0
+	combinatorChild      = '>' // the left ugen is a direct input of the right ugen
+	combinatorParent     = '<' // the right ugen is a direct input of the left ugen
+	combinatorDescendant = ' ' // the left ugen is anywhere upstream of the right ugen
+)
+
+// queryAttrPattern matches the contents of an attribute selector, e.g. "freq<=20".
+var queryAttrPattern = regexp.MustCompile(`^\s*([A-Za-z0-9_]+)\s*(!=|<=|>=|=|<|>)\s*(\S+)\s*$`)
+
+// queryRates maps the rate names accepted by the rate attribute to rates.
+var queryRates = map[string]int8{
+	"ir":      sc.IR,
+	"kr":      sc.KR,
+	"ar":      sc.AR,
+	"dr":      rateDemand,
+	"scalar":  sc.IR,
+	"control": sc.KR,
+	"audio":   sc.AR,
+	"demand":  rateDemand,
+}
+
+// queryAttr is an attribute selector, e.g. [rate=ar] or [freq=$].
+type queryAttr struct {
+	Name  string
+	Op    string
+	Value string
+}
+
+// queryCompound matches a single ugen by name and attributes, e.g. SinOsc[rate=ar].
+type queryCompound struct {
+	Name  string
+	Attrs []queryAttr
+}
+
+// queryStep is a compound selector along with the combinator that relates it to the previous step.
+type queryStep struct {
+	Combinator byte
+	Compound   queryCompound
+}
+
+// querySelector is a chain of compound selectors. It matches the ugen matched by its last step.
+type querySelector []queryStep
+
+// query is a comma-separated list of selectors. It matches any ugen that one of the selectors matches.
+type query []querySelector
+
+// parseQuery parses a query, e.g. "SinOsc[rate=ar] > BinaryOpUGen[op=*]".
+func parseQuery(s string) (query, error) {
+	var (
+		q    = query{}
+		sel  = querySelector{}
+		comb = byte(combinatorNone)
+		i    = 0
+	)
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			if len(sel) > 0 && comb == combinatorNone {
+				comb = combinatorDescendant
+			}
+			i++
+		case c == combinatorChild || c == combinatorParent:
+			if len(sel) == 0 || (comb != combinatorNone && comb != combinatorDescendant) {
+				return nil, errors.Errorf("unexpected %q at offset %d", c, i)
+			}
+			comb = c
+			i++
+		case c == ',':
+			if len(sel) == 0 || (comb != combinatorNone && comb != combinatorDescendant) {
+				return nil, errors.Errorf("unexpected ',' at offset %d", i)
+			}
+			q, sel, comb = append(q, sel), querySelector{}, combinatorNone
+			i++
+		default:
+			compound, n, err := parseQueryCompound(s[i:])
+			if err != nil {
+				return nil, errors.Wrapf(err, "at offset %d", i)
+			}
+			if len(sel) == 0 {
+				comb = combinatorNone
+			}
+			sel = append(sel, queryStep{Combinator: comb, Compound: compound})
+			comb = combinatorNone
+			i += n
+		}
+	}
+	if len(sel) == 0 || (comb != combinatorNone && comb != combinatorDescendant) {
+		return nil, errors.New("incomplete query")
+	}
+	return append(q, sel), nil
+}
+
+// parseQueryCompound parses a compound selector at the start of s
+// and returns the number of bytes it consumed.
+func parseQueryCompound(s string) (queryCompound, int, error) {
+	var (
+		compound = queryCompound{Name: "*"}
+		i        = 0
+	)
+	if s[0] == '*' {
+		i++
+	} else {
+		for i < len(s) && isQueryIdent(s[i]) {
+			i++
+		}
+		if i > 0 {
+			compound.Name = s[:i]
+		}
+	}
+	for i < len(s) && s[i] == '[' {
+		end := strings.IndexByte(s[i:], ']')
+		if end == -1 {
+			return compound, 0, errors.New("missing ]")
+		}
+		m := queryAttrPattern.FindStringSubmatch(s[i+1 : i+end])
+		if m == nil {
+			return compound, 0, errors.Errorf("bad attribute %q", s[i:i+end+1])
+		}
+		compound.Attrs = append(compound.Attrs, queryAttr{Name: m[1], Op: m[2], Value: m[3]})
+		i += end + 1
+	}
+	if i == 0 {
+		return compound, 0, errors.Errorf("unexpected %q", s[0])
+	}
+	return compound, i, nil
+}
+
+// isQueryIdent returns true if c can be part of a ugen name.
+func isQueryIdent(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// queryMatcher matches queries against the ugens of a synthdef.
+type queryMatcher struct {
+	def       *sc.Synthdef
+	cat       ugenCatalog
+	consumers [][]int32
+}
+
+// newQueryMatcher creates a queryMatcher.
+func newQueryMatcher(def *sc.Synthdef, cat ugenCatalog) *queryMatcher {
+	m := &queryMatcher{def: def, cat: cat, consumers: make([][]int32, len(def.Ugens))}
+	for i, u := range def.Ugens {
+		for _, in := range u.Inputs {
+			if !in.IsConstant() {
+				m.consumers[in.UgenIndex] = append(m.consumers[in.UgenIndex], int32(i))
+			}
+		}
+	}
+	return m
+}
+
+// match returns the indices of the ugens that match a query.
+func (m *queryMatcher) match(q query) []int32 {
+	matches := []int32{}
+	for i := range m.def.Ugens {
+		for _, sel := range q {
+			if m.matchStep(sel, len(sel)-1, int32(i)) {
+				matches = append(matches, int32(i))
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// matchStep returns true if a ugen matches step k of a selector and the steps before it.
+func (m *queryMatcher) matchStep(sel querySelector, k int, ugenIndex int32) bool {
+	if !m.matchCompound(sel[k].Compound, ugenIndex) {
+		return false
+	}
+	if k == 0 {
+		return true
+	}
+	var candidates []int32
+	switch sel[k].Combinator {
+	case combinatorChild:
+		for _, in := range m.def.Ugens[ugenIndex].Inputs {
+			if !in.IsConstant() {
+				candidates = append(candidates, in.UgenIndex)
+			}
+		}
+	case combinatorParent:
+		candidates = m.consumers[ugenIndex]
+	case combinatorDescendant:
+		candidates = m.upstream(ugenIndex)
+	}
+	for _, candidate := range candidates {
+		if m.matchStep(sel, k-1, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// upstream returns the indices of every ugen that a ugen depends on.
+func (m *queryMatcher) upstream(ugenIndex int32) []int32 {
+	var (
+		seen  = map[int32]bool{}
+		queue = []int32{ugenIndex}
+		found = []int32{}
+	)
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, in := range m.def.Ugens[i].Inputs {
+			if in.IsConstant() || seen[in.UgenIndex] {
+				continue
+			}
+			seen[in.UgenIndex] = true
+			found = append(found, in.UgenIndex)
+			queue = append(queue, in.UgenIndex)
+		}
+	}
+	return found
+}
+
+// matchCompound returns true if a ugen matches a compound selector.
+func (m *queryMatcher) matchCompound(compound queryCompound, ugenIndex int32) bool {
+	u := m.def.Ugens[ugenIndex]
+
+	if compound.Name != "*" && compound.Name != u.Name {
+		return false
+	}
+	for _, attr := range compound.Attrs {
+		if !m.matchAttr(attr, u) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAttr returns true if a ugen matches an attribute selector.
+// rate, op, and special match properties of the ugen itself.
+// Any other name matches inputs, either by catalog name or by index.
+// rate only matches the ugen rate if the value is a rate name, so [rate=1] still matches the rate input of PlayBuf.
+func (m *queryMatcher) matchAttr(attr queryAttr, u *sc.Ugen) bool {
+	switch attr.Name {
+	case "op":
+		return compareQueryStrings(attr.Op, operatorName(u), attr.Value)
+	case "special":
+		return compareQueryNumbers(attr.Op, float32(u.SpecialIndex), attr.Value)
+	case "rate":
+		if rate, ok := queryRates[attr.Value]; ok {
+			return compareQueryStrings(attr.Op, rateMethod(u.Rate), rateMethod(rate))
+		}
+	}
+	matched := false
+	for i, in := range u.Inputs {
+		if !m.isInput(attr.Name, u, i) {
+			continue
+		}
+		if m.matchInput(attr, describeInput(m.def, in)) {
+			matched = true
+			break
+		}
+	}
+	if attr.Op == "!=" {
+		return !matched
+	}
+	return matched
+}
+
+// isInput returns true if an input of a ugen has the provided name or index.
+// The name of a variadic input matches every repetition, e.g. channels matches channels[1].
+func (m *queryMatcher) isInput(name string, u *sc.Ugen, idx int) bool {
+	if n, err := strconv.Atoi(name); err == nil {
+		return n == idx
+	}
+	inputName := m.cat.inputName(u, idx)
+	return inputName == name || strings.HasPrefix(inputName, name+"[")
+}
+
+// matchInput returns true if an input source matches the value of an attribute selector.
+// A != attribute is matched as = here and negated by the caller.
+func (m *queryMatcher) matchInput(attr queryAttr, src inputSource) bool {
+	op := attr.Op
+	if op == "!=" {
+		op = "="
+	}
+	switch {
+	case attr.Value == "$":
+		return src.Kind == sourceParam && op == "="
+	case strings.HasPrefix(attr.Value, "$"):
+		name := attr.Value[1:]
+		return src.Kind == sourceParam && op == "=" && (src.Param == name || strings.HasPrefix(src.Param, name+"["))
+	case src.Kind == sourceConstant:
+		return compareQueryNumbers(op, src.Value, attr.Value)
+	case src.Kind == sourceUgen:
+		return compareQueryStrings(op, src.Ugen, attr.Value)
+	}
+	return false
+}
+
+// compareQueryStrings compares strings with = or !=.
+func compareQueryStrings(op, got, want string) bool {
+	switch op {
+	case "=":
+		return got == want
+	case "!=":
+		return got != want
+	}
+	return false
+}
+
+// compareQueryNumbers compares a number with the value of an attribute selector.
+func compareQueryNumbers(op string, got float32, value string) bool {
+	f, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return false
+	}
+	want := float32(f)
+
+	switch op {
+	case "=":
+		return got == want
+	case "!=":
+		return got != want
+	case "<":
+		return got < want
+	case ">":
+		return got > want
+	case "<=":
+		return got <= want
+	case ">=":
+		return got >= want
+	}
+	return false
+}
+
+// queryMatch is a ugen that matched a query.
+type queryMatch struct {
+	File      string `json:"file"`
+	Synthdef  string `json:"synthdef"`
+	UgenIndex int32  `json:"ugenIndex"`
+	Ugen      string `json:"ugen"`
+}
+
+// query runs the query command
+func (c *controller) query() error {
+	fset := c.flagSets["query"]
+
+	if fset.NArg() < 2 {
+		return errors.New("expected a query and at least one synthdef file or directory")
+	}
+	q, err := parseQuery(fset.Arg(0))
+	if err != nil {
+		return errors.Wrap(err, "parsing query")
+	}
+	cat, err := c.loadCatalog()
+	if err != nil {
+		return err
+	}
+	lib := []libraryEntry{}
+	for _, path := range fset.Args()[1:] {
+		entries, err := readSynthdefPath(path)
+		if err != nil {
+			return err
+		}
+		lib = append(lib, entries...)
+	}
+	matches := []queryMatch{}
+	for _, entry := range lib {
+		for _, i := range newQueryMatcher(entry.Def, cat).match(q) {
+			matches = append(matches, queryMatch{
+				File:      entry.Path,
+				Synthdef:  entry.Def.Name,
+				UgenIndex: i,
+				Ugen:      entry.Def.Ugens[i].Name,
+			})
+		}
+	}
+	switch *c.queryOutput {
+	case "json":
+		err = writeJSON(os.Stdout, matches)
+	case "text":
+		err = writeQueryMatches(os.Stdout, matches)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.queryOutput)
+	}
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return errors.New("no matches")
+	}
+	return nil
+}
+
+// writeQueryMatches writes one file:ugenIndex line per match.
+func writeQueryMatches(w io.Writer, matches []queryMatch) error {
+	for _, match := range matches {
+		fmt.Fprintf(w, "%s:%d\n", match.File, match.UgenIndex)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// renderOptions control an offline render.
+type renderOptions struct {
+	SampleRate float64
+	BlockSize  int
+	Duration   float64
+	Channels   int
+	Params     map[string]float32
+
+	// Release is the time in seconds at which the gate param is set to 0,
+	// or a negative number to never release.
+	Release float64
+
+	Seed int64
+}
+
+// check checks that a render with the options is possible.
+func (opts renderOptions) check() error {
+	if opts.SampleRate <= 0 || opts.BlockSize <= 0 || opts.Channels <= 0 || opts.Duration < 0 {
+		return errors.New("sample rate, block size, and channels must be positive, and duration must not be negative")
+	}
+	return nil
+}
+
+// signal is the output of a ugen for one block.
+// Audio rate signals have a sample for every frame of the block,
+// while constants and scalar and control rate signals have a single sample.
+type signal []float32
+
+// at returns the sample of the signal at a frame of the block.
+func (s signal) at(i int) float32 {
+	if len(s) == 1 {
+		return s[0]
+	}
+	return s[i]
+}
+
+// unit is a ugen that the renderer can run.
+type unit interface {
+	// next computes the next n samples of the outputs of the ugen.
+	// n is the block size for audio rate ugens and 1 for every other rate.
+	next(n int)
+}
+
+// unitBuilder creates the unit for the ugen at an index of a synthdef.
+// The outputs of the unit are r.outputs[idx].
+type unitBuilder func(r *renderer, idx int, u *sc.Ugen) (unit, error)
+
+// renderer interprets a synthdef one block at a time.
+type renderer struct {
+	def     *sc.Synthdef
+	opts    renderOptions
+	params  []float32
+	outputs [][]signal
+	units   []unit
+	buses   []signal
+	rng     *rand.Rand
+
+	// stopped is true once a done action has freed or paused the synth.
+	stopped bool
+}
+
+// newRenderer creates a renderer for a synthdef.
+// It returns an error that names every ugen it cannot render.
+func newRenderer(def *sc.Synthdef, opts renderOptions) (*renderer, error) {
+	unsupported := []string{}
+	for i, u := range def.Ugens {
+		if _, ok := renderUgens[u.Name]; !ok || u.Rate == rateDemand {
+			unsupported = append(unsupported, fmt.Sprintf("%s(%d)", u.Name, i))
+		}
+	}
+	if len(unsupported) > 0 {
+		return nil, errors.Errorf("cannot render %s, unsupported ugens: %s", def.Name, strings.Join(unsupported, ", "))
+	}
+	r := &renderer{
+		def:     def,
+		opts:    opts,
+		params:  make([]float32, len(def.InitialParamValues)),
+		outputs: make([][]signal, len(def.Ugens)),
+		units:   make([]unit, len(def.Ugens)),
+		buses:   make([]signal, opts.Channels),
+		rng:     rand.New(rand.NewSource(opts.Seed)),
+	}
+	for i := range r.params {
+		r.params[i] = paramValue(def, int32(i), opts.Params)
+	}
+	for i := range r.buses {
+		r.buses[i] = make(signal, opts.BlockSize)
+	}
+	for i, u := range def.Ugens {
+		r.outputs[i] = make([]signal, len(u.Outputs))
+		for oi := range u.Outputs {
+			r.outputs[i][oi] = make(signal, r.blockLength(u.Rate))
+		}
+	}
+	for i, u := range def.Ugens {
+		for ii, in := range u.Inputs {
+			if !in.IsConstant() && (in.UgenIndex < 0 || int(in.UgenIndex) >= i) {
+				return nil, errors.Errorf("%s(%d) input %d comes from ugen %d, which does not run before it", u.Name, i, ii, in.UgenIndex)
+			}
+		}
+		unit, err := renderUgens[u.Name](r, i, u)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s(%d)", u.Name, i)
+		}
+		r.units[i] = unit
+	}
+	return r, nil
+}
+
+// blockLength returns the number of samples per block of a rate.
+func (r *renderer) blockLength(rate int8) int {
+	if rate == sc.AR {
+		return r.opts.BlockSize
+	}
+	return 1
+}
+
+// sampleRate returns the number of samples per second of a rate.
+func (r *renderer) sampleRate(rate int8) float64 {
+	if rate == sc.AR {
+		return r.opts.SampleRate
+	}
+	return r.opts.SampleRate / float64(r.opts.BlockSize)
+}
+
+// input returns the signal of an input of a ugen.
+func (r *renderer) input(u *sc.Ugen, idx int) signal {
+	if idx >= len(u.Inputs) {
+		return signal{0}
+	}
+	in := u.Inputs[idx]
+	if in.IsConstant() {
+		return signal{r.def.Constants[in.OutputIndex]}
+	}
+	return r.outputs[in.UgenIndex][in.OutputIndex]
+}
+
+// doneAction performs the done action of a ugen that has finished.
+// Done actions that act on other nodes are ignored.
+func (r *renderer) doneAction(action float32) {
+	if a := int(action); a == sc.Pause || freesSynth(a) {
+		r.stopped = true
+	}
+}
+
+// setParam sets every value of a param.
+func (r *renderer) setParam(name string, value float32) {
+	for _, slice := range paramSlices(r.def) {
+		if slice.Name != name {
+			continue
+		}
+		for i := slice.Index; i < slice.Index+slice.Length && int(i) < len(r.params); i++ {
+			r.params[i] = value
+		}
+	}
+}
+
+// render runs the synth for the duration of the render and returns the samples of each output channel.
+// Scalar rate ugens run once before the first block. Once the synth has been freed, the rest is silence.
+func (r *renderer) render() [][]float32 {
+	var (
+		frames   = int(r.opts.Duration*r.opts.SampleRate + 0.5)
+		channels = make([][]float32, r.opts.Channels)
+		released = r.opts.Release < 0
+	)
+	for ch := range channels {
+		channels[ch] = make([]float32, frames)
+	}
+	for i, u := range r.def.Ugens {
+		if u.Rate == sc.IR {
+			r.units[i].next(1)
+		}
+	}
+	for pos := 0; pos < frames && !r.stopped; pos += r.opts.BlockSize {
+		if !released && float64(pos) >= r.opts.Release*r.opts.SampleRate {
+			r.setParam(gateParam, 0)
+			released = true
+		}
+		for _, bus := range r.buses {
+			for i := range bus {
+				bus[i] = 0
+			}
+		}
+		for i, u := range r.def.Ugens {
+			if u.Rate != sc.IR {
+				r.units[i].next(r.blockLength(u.Rate))
+			}
+		}
+		for ch, bus := range r.buses {
+			copy(channels[ch][pos:], bus)
+		}
+	}
+	return channels
+}
+
+// render runs the render command
+func (c *controller) render() error {
+	fset := c.flagSets["render"]
+
+	if fset.NArg() != 1 {
+		return errors.New("expected one synthdef file")
+	}
+	if *c.renderOut == "" {
+		return errors.New("expected -out")
+	}
+	opts := renderOptions{
+		SampleRate: *c.renderSampleRate,
+		BlockSize:  *c.renderBlockSize,
+		Duration:   *c.renderDuration,
+		Channels:   *c.renderChannels,
+		Params:     c.renderParams,
+		Release:    *c.renderRelease,
+		Seed:       *c.renderSeed,
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+	def, err := readSynthdefFile(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	if opts.Release >= 0 && !hasParam(def, gateParam) {
+		return errors.Errorf("-release needs a %s param", gateParam)
+	}
+	r, err := newRenderer(def, opts)
+	if err != nil {
+		return err
+	}
+	return writeWAVFile(*c.renderOut, int(opts.SampleRate), *c.renderBits, r.render())
+}
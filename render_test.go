@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/scgolang/sc"
+)
+
+// testSampleRate and testBlockSize are the render options of the renderer tests.
+const (
+	testSampleRate = 44100
+	testBlockSize  = 64
+)
+
+// envSine is a 441 Hz sine with an envelope that the gate param releases after 0.1s.
+func envSine(done int) *sc.Synthdef {
+	return sc.NewSynthdef("envsine", func(p sc.Params) sc.Ugen {
+		env := sc.EnvGen{
+			Env:  sc.Env{Levels: []sc.Input{sc.C(0), sc.C(1), sc.C(0)}, Times: []sc.Input{sc.C(0.01), sc.C(0.1)}, ReleaseNode: sc.C(1)},
+			Gate: p.Add(gateParam, 1),
+			Done: done,
+		}.Rate(sc.KR)
+		return sc.Out{Bus: sc.C(0), Channels: sc.SinOsc{Freq: sc.C(441)}.Rate(sc.AR).Mul(env)}.Rate(sc.AR)
+	})
+}
+
+// lastSound returns the time in seconds of the last non-zero sample, or -1 if there is none.
+func lastSound(samples []float32) float64 {
+	for i := len(samples) - 1; i >= 0; i-- {
+		if samples[i] != 0 {
+			return float64(i) / testSampleRate
+		}
+	}
+	return -1
+}
+
+func TestRender(t *testing.T) {
+	blockDur := float64(testBlockSize) / testSampleRate
+
+	for _, tc := range []struct {
+		name     string
+		def      *sc.Synthdef
+		release  float64
+		stopped  bool
+		checkOut func(t *testing.T, out []float32)
+	}{
+		{
+			name: "SinOsc peak and frequency",
+			def: sc.NewSynthdef("sine", func(p sc.Params) sc.Ugen {
+				return sc.Out{Bus: sc.C(0), Channels: sc.SinOsc{Freq: sc.C(441)}.Rate(sc.AR)}.Rate(sc.AR)
+			}),
+			release: -1,
+			checkOut: func(t *testing.T, out []float32) {
+				peak, crossings := 0.0, 0
+				for i, v := range out {
+					peak = math.Max(peak, math.Abs(float64(v)))
+					if i > 0 && out[i-1] < 0 && v >= 0 {
+						crossings++
+					}
+				}
+				if peak < 0.999 || peak > 1.0001 {
+					t.Errorf("expected a peak of 1, got %g", peak)
+				}
+				if crossings < 440 || crossings > 441 {
+					t.Errorf("expected 441 cycles in 1s, got %d", crossings)
+				}
+			},
+		},
+		{
+			name:    "EnvGen release with doneAction 2",
+			def:     envSine(sc.FreeEnclosing),
+			release: 0.5,
+			stopped: true,
+			checkOut: func(t *testing.T, out []float32) {
+				// The release takes 0.1s from the block the gate closes in, and the synth is
+				// freed at the end of the block the envelope ends in.
+				if last := lastSound(out); last < 0.59 || last > 0.6+2*blockDur {
+					t.Errorf("expected the sound to end 0.1s after the release at 0.5s, it ended at %gs", last)
+				}
+			},
+		},
+		{
+			name:    "EnvGen held without a release",
+			def:     envSine(sc.FreeEnclosing),
+			release: -1,
+			checkOut: func(t *testing.T, out []float32) {
+				if last := lastSound(out); last < 1-blockDur {
+					t.Errorf("expected the sound to last the whole render, it ended at %gs", last)
+				}
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newRenderer(tc.def, renderOptions{
+				SampleRate: testSampleRate,
+				BlockSize:  testBlockSize,
+				Duration:   1,
+				Channels:   1,
+				Release:    tc.release,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := r.render()
+			if len(out) != 1 || len(out[0]) != testSampleRate {
+				t.Fatalf("expected 1 channel of %d samples, got %d channel(s)", testSampleRate, len(out))
+			}
+			if r.stopped != tc.stopped {
+				t.Errorf("expected stopped to be %t, got %t", tc.stopped, r.stopped)
+			}
+			tc.checkOut(t, out[0])
+		})
+	}
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	in := [][]float32{
+		{0, 0.5, -0.5, 1, -1, 0.25},
+		{0.125, -0.25, 0.75, -0.75, 0, 0.001},
+	}
+	for _, tc := range []struct {
+		bits      int
+		tolerance float64
+	}{
+		{bits: 16, tolerance: 1.0 / math.MaxInt16},
+		{bits: 24, tolerance: 1.0 / (1<<23 - 1)},
+		{bits: 32},
+	} {
+		buf := &bytes.Buffer{}
+		if err := writeWAV(buf, testSampleRate, tc.bits, in); err != nil {
+			t.Fatal(err)
+		}
+		sampleRate, out, err := readWAV(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("%d bits: %s", tc.bits, err)
+		}
+		if sampleRate != testSampleRate {
+			t.Errorf("%d bits: expected sample rate %d, got %d", tc.bits, testSampleRate, sampleRate)
+		}
+		if len(out) != len(in) {
+			t.Fatalf("%d bits: expected %d channels, got %d", tc.bits, len(in), len(out))
+		}
+		for ch := range in {
+			if len(out[ch]) != len(in[ch]) {
+				t.Fatalf("%d bits: expected %d frames, got %d", tc.bits, len(in[ch]), len(out[ch]))
+			}
+			for i := range in[ch] {
+				if d := math.Abs(float64(out[ch][i] - in[ch][i])); d > tc.tolerance {
+					t.Errorf("%d bits: channel %d frame %d: expected %g, got %g", tc.bits, ch, i, in[ch][i], out[ch][i])
+				}
+			}
+		}
+	}
+}
+
+func TestReadWAVChunkSizes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := writeWAV(buf, testSampleRate, 32, [][]float32{{0.5, -0.5}}); err != nil {
+		t.Fatal(err)
+	}
+	// A streaming writer leaves the size of the data chunk unset, which reads to the end of the file.
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[40:], math.MaxUint32)
+	if _, out, err := readWAV(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	} else if len(out) != 1 || len(out[0]) != 2 {
+		t.Fatalf("expected 1 channel of 2 frames, got %v", out)
+	}
+
+	// Any other chunk that claims to be bigger than the file is an error.
+	binary.LittleEndian.PutUint32(data[16:], math.MaxUint32)
+	if _, _, err := readWAV(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Fatal("expected an error for a fmt chunk bigger than the file")
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// bytesPerSample is the size of a sample in scsynth's wire buffers, delay lines, and buffers.
+const bytesPerSample = 4
+
+// delayLineInputs maps the names of ugens that allocate a delay line from real-time memory
+// to the index of their maxdelaytime input.
+var delayLineInputs = map[string]int{
+	"AllpassC": 1,
+	"AllpassL": 1,
+	"AllpassN": 1,
+	"CombC":    1,
+	"CombL":    1,
+	"CombN":    1,
+	"DelayC":   1,
+	"DelayL":   1,
+	"DelayN":   1,
+	"Pluck":    2,
+}
+
+// serverOptions are the scsynth options that limit the resources of a synth.
+type serverOptions struct {
+	SampleRate float64
+	BlockSize  int
+	WireBufs   int // scsynth -w
+	RTMemoryKB int // scsynth -m
+
+	// Instances is the number of synths that run at the same time.
+	Instances int
+}
+
+// rtAllocation is a single allocation of real-time memory made by a ugen.
+type rtAllocation struct {
+	Ugen      string `json:"ugen"`
+	UgenIndex int    `json:"ugenIndex"`
+	Bytes     int    `json:"bytes"`
+	Detail    string `json:"detail"`
+}
+
+// resourceReport is the resource estimate for a single synthdef file.
+type resourceReport struct {
+	File        string         `json:"file"`
+	Synthdef    string         `json:"synthdef"`
+	WireBufs    int            `json:"wireBufs"`
+	PeakAt      int            `json:"peakAt"`
+	Allocations []rtAllocation `json:"allocations"`
+	RTMemory    int            `json:"rtMemory"`
+	Warnings    []string       `json:"warnings,omitempty"`
+	Problems    []string       `json:"problems,omitempty"`
+}
+
+// wireBufs returns the peak number of audio rate wires that are live at the same time
+// when the ugens run in synthdef order, and the index of the ugen at which the peak is reached.
+// Like scsynth's buffer coloring, a wire is live from the ugen that writes it until its last consumer
+// has run, inputs are released before outputs are allocated so a ugen can reuse its input's buffer,
+// and outputs that nothing consumes are released right after their ugen.
+func wireBufs(def *sc.Synthdef) (int, int) {
+	type wire struct{ ugen, output int32 }
+	var (
+		refs       = map[wire]int{}
+		live, peak = 0, 0
+		peakAt     = -1
+	)
+	for _, u := range def.Ugens {
+		for _, in := range u.Inputs {
+			if !in.IsConstant() && def.Ugens[in.UgenIndex].Rate == sc.AR {
+				refs[wire{in.UgenIndex, in.OutputIndex}]++
+			}
+		}
+	}
+	for i, u := range def.Ugens {
+		for _, in := range u.Inputs {
+			w := wire{in.UgenIndex, in.OutputIndex}
+			if in.IsConstant() || def.Ugens[in.UgenIndex].Rate != sc.AR {
+				continue
+			}
+			if refs[w]--; refs[w] == 0 {
+				live--
+			}
+		}
+		if u.Rate != sc.AR {
+			continue
+		}
+		live += len(u.Outputs)
+		if live > peak {
+			peak, peakAt = live, i
+		}
+		for oi := range u.Outputs {
+			if refs[wire{int32(i), int32(oi)}] == 0 {
+				live--
+			}
+		}
+	}
+	return peak, peakAt
+}
+
+// nextPowerOfTwo returns the smallest power of two that is at least n.
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// rtAllocations estimates the real-time memory allocated by the ugens of a synthdef.
+// Delay lines are sized the way scsynth sizes them: maxdelaytime in samples plus one block,
+// rounded up to a power of two. Inputs that come from params are resolved with their initial values.
+func rtAllocations(def *sc.Synthdef, opts serverOptions) ([]rtAllocation, []string) {
+	var (
+		allocs   = []rtAllocation{}
+		warnings = []string{}
+	)
+	resolve := func(i int, u *sc.Ugen, idx int, what string) (float32, bool) {
+		src := describeInput(def, u.Inputs[idx])
+		value, ok := resolveInput(def, src, nil)
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("%s(%d) has its %s %s, so its memory is not counted", u.Name, i, what, describeSource(src)))
+		case src.Kind == sourceParam:
+			warnings = append(warnings, fmt.Sprintf("%s(%d) has its %s set by param %s, counted with its initial value %g", u.Name, i, what, src.Param, value))
+		}
+		return value, ok
+	}
+	for i, u := range def.Ugens {
+		if idx, ok := delayLineInputs[u.Name]; ok && idx < len(u.Inputs) {
+			maxDelay, ok := resolve(i, u, idx, "maxdelaytime")
+			if !ok {
+				continue
+			}
+			sampleRate, block := opts.SampleRate, opts.BlockSize
+			if u.Rate != sc.AR {
+				sampleRate, block = opts.SampleRate/float64(opts.BlockSize), 1
+			}
+			samples := nextPowerOfTwo(int(math.Ceil(float64(maxDelay)*sampleRate+1)) + block)
+			allocs = append(allocs, rtAllocation{
+				Ugen:      u.Name,
+				UgenIndex: i,
+				Bytes:     samples * bytesPerSample,
+				Detail:    fmt.Sprintf("maxdelaytime %gs, %d samples", maxDelay, samples),
+			})
+			continue
+		}
+		if u.Name == "LocalBuf" && len(u.Inputs) >= 2 {
+			channels, ok := resolve(i, u, 0, "numChannels")
+			if !ok {
+				continue
+			}
+			frames, ok := resolve(i, u, 1, "numFrames")
+			if !ok {
+				continue
+			}
+			allocs = append(allocs, rtAllocation{
+				Ugen:      u.Name,
+				UgenIndex: i,
+				Bytes:     int(channels) * int(frames) * bytesPerSample,
+				Detail:    fmt.Sprintf("%d channel(s), %d frames", int(channels), int(frames)),
+			})
+		}
+	}
+	return allocs, warnings
+}
+
+// estimateResources estimates the resources a synthdef needs and checks them against the server options.
+func estimateResources(entry libraryEntry, opts serverOptions) resourceReport {
+	def := entry.Def
+	report := resourceReport{File: entry.Path, Synthdef: def.Name}
+	report.WireBufs, report.PeakAt = wireBufs(def)
+	report.Allocations, report.Warnings = rtAllocations(def, opts)
+
+	for _, alloc := range report.Allocations {
+		report.RTMemory += alloc.Bytes
+	}
+	if report.WireBufs > opts.WireBufs {
+		report.Problems = append(report.Problems, fmt.Sprintf("needs %d wire buffers, server has %d (-w)", report.WireBufs, opts.WireBufs))
+	}
+	if total, limit := report.RTMemory*opts.Instances, opts.RTMemoryKB*1024; total > limit {
+		report.Problems = append(report.Problems, fmt.Sprintf("%d instance(s) need %s of real-time memory, server has %s (-m)", opts.Instances, formatBytes(total), formatBytes(limit)))
+	}
+	return report
+}
+
+// formatBytes formats a byte count in KB, the unit of scsynth's -m option.
+func formatBytes(n int) string {
+	return fmt.Sprintf("%.1f KB", float64(n)/1024)
+}
+
+// resources runs the resources command
+func (c *controller) resources() error {
+	fset := c.flagSets["resources"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file or directory")
+	}
+	opts := serverOptions{
+		SampleRate: *c.resourcesSampleRate,
+		BlockSize:  *c.resourcesBlockSize,
+		WireBufs:   *c.resourcesWireBufs,
+		RTMemoryKB: *c.resourcesRTMemory,
+		Instances:  *c.resourcesInstances,
+	}
+	if opts.SampleRate <= 0 || opts.BlockSize <= 0 || opts.Instances <= 0 {
+		return errors.New("sample rate, block size, and instances must be positive")
+	}
+	var (
+		reports  = []resourceReport{}
+		problems = 0
+	)
+	for _, path := range fset.Args() {
+		entries, err := readSynthdefPath(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			report := estimateResources(entry, opts)
+			problems += len(report.Problems)
+			reports = append(reports, report)
+		}
+	}
+	var err error
+	switch *c.resourcesOutput {
+	case "json":
+		err = writeJSON(os.Stdout, reports)
+	case "text":
+		err = writeResources(os.Stdout, reports)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.resourcesOutput)
+	}
+	if err != nil {
+		return err
+	}
+	if problems > 0 {
+		return errors.Errorf("found %d resource problem(s)", problems)
+	}
+	return nil
+}
+
+// writeResources writes a human-readable resource report.
+func writeResources(w io.Writer, reports []resourceReport) error {
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s (%s)\n", report.File, report.Synthdef)
+		if report.PeakAt >= 0 {
+			fmt.Fprintf(w, "  wire buffers: %d (peak at ugen %d)\n", report.WireBufs, report.PeakAt)
+		} else {
+			fmt.Fprintf(w, "  wire buffers: 0\n")
+		}
+		fmt.Fprintf(w, "  real-time memory: %s\n", formatBytes(report.RTMemory))
+		for _, alloc := range report.Allocations {
+			fmt.Fprintf(w, "    %-20s %10s  %s\n", fmt.Sprintf("%s(%d)", alloc.Ugen, alloc.UgenIndex), formatBytes(alloc.Bytes), alloc.Detail)
+		}
+		for _, warning := range report.Warnings {
+			fmt.Fprintf(w, "  warning: %s\n", warning)
+		}
+		for _, problem := range report.Problems {
+			fmt.Fprintf(w, "  problem: %s\n", problem)
+		}
+	}
+	return nil
+}
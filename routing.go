@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// Bus flags.
+const (
+	busReadOnly  = "read-only"
+	busWriteOnly = "write-only"
+)
+
+// instance is a synth instance with param assignments.
+type instance struct {
+	Name     string             `json:"name"`
+	Synthdef string             `json:"synthdef"`
+	Params   map[string]float32 `json:"params,omitempty"`
+}
+
+// readInstances reads a JSON array of synth instances from a file.
+func readInstances(path string) ([]instance, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	instances := []instance{}
+	if err := json.NewDecoder(f).Decode(&instances); err != nil {
+		return nil, errors.Wrap(err, "decoding "+path)
+	}
+	return instances, nil
+}
+
+// defaultInstances creates one instance per synthdef, using the initial param values.
+func defaultInstances(lib []libraryEntry) []instance {
+	instances := make([]instance, len(lib))
+	for i, entry := range lib {
+		instances[i] = instance{Name: entry.Def.Name, Synthdef: entry.Def.Name}
+	}
+	return instances
+}
+
+// findSynthdef finds a synthdef by name.
+func findSynthdef(lib []libraryEntry, name string) (*sc.Synthdef, bool) {
+	for _, entry := range lib {
+		if entry.Def.Name == name {
+			return entry.Def, true
+		}
+	}
+	return nil, false
+}
+
+// busKey identifies a single channel of a bus.
+type busKey struct {
+	Rate  string
+	Index int
+}
+
+// busEndpoint is a ugen in a synth instance that reads from or writes to a bus.
+type busEndpoint struct {
+	Synth     string `json:"synth"`
+	Ugen      string `json:"ugen"`
+	UgenIndex int    `json:"ugenIndex"`
+}
+
+// routedBus is a bus channel in the routing graph.
+type routedBus struct {
+	Rate     string        `json:"rate"`
+	Index    int           `json:"index"`
+	Hardware string        `json:"hardware,omitempty"`
+	Flag     string        `json:"flag,omitempty"`
+	Writers  []busEndpoint `json:"writers,omitempty"`
+	Readers  []busEndpoint `json:"readers,omitempty"`
+}
+
+// unresolvedAccess is a bus access whose bus index is computed by a ugen.
+type unresolvedAccess struct {
+	busEndpoint
+	Direction string      `json:"direction"`
+	Bus       inputSource `json:"bus"`
+}
+
+// routingGraph shows which synths write to and read from which buses.
+type routingGraph struct {
+	Synths     []instance         `json:"synths"`
+	Buses      []*routedBus       `json:"buses"`
+	Unresolved []unresolvedAccess `json:"unresolved,omitempty"`
+}
+
+// newRoutingGraph creates a routing graph for a set of synth instances.
+// hwOutputs and hwInputs are the number of hardware output and input audio buses.
+func newRoutingGraph(lib []libraryEntry, instances []instance, hwOutputs, hwInputs int) (*routingGraph, error) {
+	var (
+		g     = &routingGraph{Synths: instances}
+		buses = map[busKey]*routedBus{}
+	)
+	for _, inst := range instances {
+		def, ok := findSynthdef(lib, inst.Synthdef)
+		if !ok {
+			return nil, errors.Errorf("instance %s: synthdef %s not found", inst.Name, inst.Synthdef)
+		}
+		for _, ba := range busAccesses(def) {
+			if ba.Local || ba.Bus == nil {
+				continue
+			}
+			endpoint := busEndpoint{Synth: inst.Name, Ugen: ba.Ugen, UgenIndex: ba.UgenIndex}
+
+			first, ok := resolveInput(def, *ba.Bus, inst.Params)
+			if !ok {
+				g.Unresolved = append(g.Unresolved, unresolvedAccess{
+					busEndpoint: endpoint,
+					Direction:   ba.Direction,
+					Bus:         *ba.Bus,
+				})
+				continue
+			}
+			for ch := 0; ch < ba.Channels; ch++ {
+				key := busKey{Rate: ba.Rate, Index: int(first) + ch}
+				bus, ok := buses[key]
+				if !ok {
+					bus = &routedBus{Rate: key.Rate, Index: key.Index}
+					buses[key] = bus
+				}
+				if ba.Direction == busWrite {
+					bus.Writers = append(bus.Writers, endpoint)
+				} else {
+					bus.Readers = append(bus.Readers, endpoint)
+				}
+			}
+		}
+	}
+	for _, bus := range buses {
+		bus.flag(hwOutputs, hwInputs)
+		g.Buses = append(g.Buses, bus)
+	}
+	sort.Slice(g.Buses, func(i, j int) bool {
+		if g.Buses[i].Rate != g.Buses[j].Rate {
+			return g.Buses[i].Rate < g.Buses[j].Rate
+		}
+		return g.Buses[i].Index < g.Buses[j].Index
+	})
+	return g, nil
+}
+
+// flag flags buses that are only written or only read.
+// Hardware output buses are expected to only be written,
+// and hardware input buses are expected to only be read.
+func (bus *routedBus) flag(hwOutputs, hwInputs int) {
+	if bus.Rate == rateName(sc.AR) {
+		if bus.Index < hwOutputs {
+			bus.Hardware = "output"
+		} else if bus.Index < hwOutputs+hwInputs {
+			bus.Hardware = "input"
+		}
+	}
+	if len(bus.Readers) == 0 && bus.Hardware != "output" {
+		bus.Flag = busWriteOnly
+	}
+	if len(bus.Writers) == 0 && bus.Hardware != "input" {
+		bus.Flag = busReadOnly
+	}
+}
+
+// id returns the DOT node ID of the bus.
+func (bus *routedBus) id() string {
+	return fmt.Sprintf("bus:%s:%d", bus.Rate, bus.Index)
+}
+
+// writeDot writes the routing graph in DOT format.
+func (g *routingGraph) writeDot(w io.Writer) error {
+	fmt.Fprintf(w, "digraph routing {\n")
+	fmt.Fprintf(w, "\trankdir=LR;\n")
+
+	for _, inst := range g.Synths {
+		fmt.Fprintf(w, "\t%q [shape=box, label=%q];\n", "synth:"+inst.Name, inst.Name+"\n("+inst.Synthdef+")")
+	}
+	for _, bus := range g.Buses {
+		label := fmt.Sprintf("%s %d", bus.Rate, bus.Index)
+		if bus.Hardware != "" {
+			label += "\n(hardware " + bus.Hardware + ")"
+		}
+		attrs := fmt.Sprintf("shape=ellipse, label=%q", label)
+		if bus.Flag != "" {
+			attrs += fmt.Sprintf(", color=red, xlabel=%q", bus.Flag)
+		}
+		fmt.Fprintf(w, "\t%q [%s];\n", bus.id(), attrs)
+	}
+	for _, bus := range g.Buses {
+		for _, e := range bus.Writers {
+			fmt.Fprintf(w, "\t%q -> %q [label=%q];\n", "synth:"+e.Synth, bus.id(), e.Ugen)
+		}
+		for _, e := range bus.Readers {
+			fmt.Fprintf(w, "\t%q -> %q [label=%q];\n", bus.id(), "synth:"+e.Synth, e.Ugen)
+		}
+	}
+	for _, ua := range g.Unresolved {
+		fmt.Fprintf(w, "\t// %s: %s(%d) %ss a computed bus (%s)\n", ua.Synth, ua.Ugen, ua.UgenIndex, ua.Direction, ua.Bus)
+	}
+	fmt.Fprintf(w, "}\n")
+	return nil
+}
+
+// routing runs the routing command
+func (c *controller) routing() error {
+	fset := c.flagSets["routing"]
+
+	if expected, got := 1, fset.NArg(); expected != got {
+		return errors.Errorf("expected %d args, got %d", expected, got)
+	}
+	lib, err := readSynthdefDir(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	instances := defaultInstances(lib)
+
+	if *c.routingParams != "" {
+		if instances, err = readInstances(*c.routingParams); err != nil {
+			return err
+		}
+	}
+	g, err := newRoutingGraph(lib, instances, *c.routingHWOutputs, *c.routingHWInputs)
+	if err != nil {
+		return err
+	}
+	switch *c.routingOutput {
+	case "dot":
+		return g.writeDot(os.Stdout)
+	case "json":
+		return writeJSON(os.Stdout, g)
+	default:
+		return errors.Errorf("unsupported output format %q", *c.routingOutput)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/osc"
+	"github.com/scgolang/sc"
+)
+
+// OSC addresses of the commands in NRT scores.
+const (
+	controlSetAddress   = "/c_set"
+	nodeFreeAddress     = "/n_free"
+	nodeSetAddress      = "/n_set"
+	synthNewAddress     = "/s_new"
+	synthdefRecvAddress = "/d_recv"
+)
+
+// firstScoreNodeID is the node ID of the first synth in a score.
+const firstScoreNodeID int32 = 1000
+
+// scoreTimetag converts a time in seconds from the start of an NRT score to a timetag.
+// NRT timetags count from zero rather than from 1900, so osc.FromTime does not apply.
+func scoreTimetag(seconds float64) osc.Timetag {
+	return osc.Timetag(uint64(seconds * (1 << 32)))
+}
+
+// scoreSeconds converts an NRT score timetag to seconds.
+func scoreSeconds(tt osc.Timetag) float64 {
+	return float64(tt) / (1 << 32)
+}
+
+// writeScore writes bundles as an NRT score, which is each bundle preceded by its length.
+func writeScore(w io.Writer, bundles []osc.Bundle) error {
+	for _, b := range bundles {
+		data := b.Bytes()
+		if err := binary.Write(w, binary.BigEndian, int32(len(data))); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeScoreFile writes an NRT score file.
+func writeScoreFile(path string, bundles []osc.Bundle) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := writeScore(bw, bundles); err != nil {
+		_ = f.Close() // Best effort.
+		return errors.Wrap(err, "writing "+path)
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close() // Best effort.
+		return errors.Wrap(err, "writing "+path)
+	}
+	return f.Close()
+}
+
+// scoreEvent is a synth in an event list.
+type scoreEvent struct {
+	Time     float64            `json:"time"`
+	Synthdef string             `json:"synthdef"`
+	Params   map[string]float32 `json:"params"`
+
+	// Duration is the time in seconds after which the synth is released,
+	// or zero if the synth frees itself.
+	Duration float64 `json:"duration"`
+}
+
+// readScoreEvents reads an event list from a JSON file, or from a CSV file if the
+// extension is .csv.
+func readScoreEvents(path string) ([]scoreEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		events, err := readScoreEventsCSV(f)
+		return events, errors.Wrap(err, "reading "+path)
+	}
+	events := []scoreEvent{}
+	if err := json.NewDecoder(f).Decode(&events); err != nil {
+		return nil, errors.Wrap(err, "decoding "+path)
+	}
+	return events, nil
+}
+
+// readScoreEventsCSV reads an event list from CSV with a header row.
+// The time and synthdef columns are required and the duration column is optional.
+// Every other column is a param, and empty cells leave the param at its default.
+func readScoreEventsCSV(r io.Reader) ([]scoreEvent, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading header")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"time", "synthdef"} {
+		if _, ok := columns[required]; !ok {
+			return nil, errors.Errorf("expected a %s column", required)
+		}
+	}
+	events := []scoreEvent{}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ev := scoreEvent{Synthdef: record[columns["synthdef"]], Params: map[string]float32{}}
+		for name, i := range columns {
+			cell := strings.TrimSpace(record[i])
+			if name == "synthdef" || cell == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(cell, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d, column %s", line, name)
+			}
+			switch name {
+			case "time":
+				ev.Time = v
+			case "duration":
+				ev.Duration = v
+			default:
+				ev.Params[name] = float32(v)
+			}
+		}
+		events = append(events, ev)
+	}
+}
+
+// scoreCommand is an OSC message at a time in an NRT score.
+type scoreCommand struct {
+	Time    float64
+	Message osc.Message
+}
+
+// scoreBuilder collects the commands of an NRT score.
+type scoreBuilder struct {
+	defs     []*sc.Synthdef
+	byName   map[string]*sc.Synthdef
+	commands []scoreCommand
+	nextNode int32
+}
+
+// newScoreBuilder creates a score builder that can start synths from a set of synthdefs.
+func newScoreBuilder(entries []libraryEntry) (*scoreBuilder, error) {
+	b := &scoreBuilder{byName: map[string]*sc.Synthdef{}, nextNode: firstScoreNodeID}
+	for _, entry := range entries {
+		if _, ok := b.byName[entry.Def.Name]; ok {
+			return nil, errors.Errorf("synthdef %s is defined more than once, last in %s", entry.Def.Name, entry.Path)
+		}
+		b.byName[entry.Def.Name] = entry.Def
+		b.defs = append(b.defs, entry.Def)
+	}
+	return b, nil
+}
+
+// add adds a command to the score.
+func (b *scoreBuilder) add(seconds float64, address string, args ...osc.Argument) {
+	b.commands = append(b.commands, scoreCommand{
+		Time:    seconds,
+		Message: osc.Message{Address: address, Arguments: args},
+	})
+}
+
+// synth starts a synth at the tail of the root node and returns its node ID.
+func (b *scoreBuilder) synth(seconds float64, defName string, params map[string]float32) (int32, error) {
+	def, ok := b.byName[defName]
+	if !ok {
+		return 0, errors.Errorf("unknown synthdef %s", defName)
+	}
+	if err := checkParams(def, params); err != nil {
+		return 0, err
+	}
+	id := b.nextNode
+	b.nextNode++
+
+	args := []osc.Argument{osc.String(defName), osc.Int(id), osc.Int(sc.AddToTail), osc.Int(sc.RootNodeID)}
+	b.add(seconds, synthNewAddress, append(args, controlArgs(params)...)...)
+	return id, nil
+}
+
+// set sets params of a synth.
+func (b *scoreBuilder) set(seconds float64, id int32, params map[string]float32) {
+	b.add(seconds, nodeSetAddress, append([]osc.Argument{osc.Int(id)}, controlArgs(params)...)...)
+}
+
+// release releases a synth by setting its gate param to 0,
+// or frees it if its synthdef has no gate param.
+func (b *scoreBuilder) release(seconds float64, id int32, defName string) {
+	if def, ok := b.byName[defName]; ok && hasParam(def, gateParam) {
+		b.set(seconds, id, map[string]float32{gateParam: 0})
+		return
+	}
+	b.add(seconds, nodeFreeAddress, osc.Int(id))
+}
+
+// event adds the commands of an event to the score.
+func (b *scoreBuilder) event(ev scoreEvent) error {
+	if ev.Time < 0 || ev.Duration < 0 {
+		return errors.Errorf("%s event at %gs has a negative time or duration", ev.Synthdef, ev.Time)
+	}
+	id, err := b.synth(ev.Time, ev.Synthdef, ev.Params)
+	if err != nil {
+		return errors.Wrapf(err, "event at %gs", ev.Time)
+	}
+	if ev.Duration > 0 {
+		b.release(ev.Time+ev.Duration, id, ev.Synthdef)
+	}
+	return nil
+}
+
+// bundles returns the bundles of the score in time order. The first bundle loads every synthdef,
+// and the last one is a /c_set of bus 0 at the end time, which is where scsynth stops rendering.
+// If end is less than the time of the last command, the score ends with the last command.
+func (b *scoreBuilder) bundles(end float64) ([]osc.Bundle, error) {
+	load := osc.Bundle{Timetag: scoreTimetag(0)}
+	for _, def := range b.defs {
+		data, err := synthdefBytes(def)
+		if err != nil {
+			return nil, errors.Wrap(err, "encoding "+def.Name)
+		}
+		load.Packets = append(load.Packets, osc.Message{
+			Address:   synthdefRecvAddress,
+			Arguments: []osc.Argument{osc.Blob(data)},
+		})
+	}
+	commands := append([]scoreCommand{}, b.commands...)
+	sort.SliceStable(commands, func(i, j int) bool { return commands[i].Time < commands[j].Time })
+	if n := len(commands); n > 0 && commands[n-1].Time > end {
+		end = commands[n-1].Time
+	}
+	commands = append(commands, scoreCommand{
+		Time:    end,
+		Message: osc.Message{Address: controlSetAddress, Arguments: []osc.Argument{osc.Int(0), osc.Float(0)}},
+	})
+	bundles := []osc.Bundle{load}
+	for _, cmd := range commands {
+		tt := scoreTimetag(cmd.Time)
+		if last := &bundles[len(bundles)-1]; last.Timetag == tt {
+			last.Packets = append(last.Packets, cmd.Message)
+			continue
+		}
+		bundles = append(bundles, osc.Bundle{Timetag: tt, Packets: []osc.Packet{cmd.Message}})
+	}
+	return bundles, nil
+}
+
+// controlArgs returns the name and value arguments of params, sorted by name.
+func controlArgs(params map[string]float32) []osc.Argument {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]osc.Argument, 0, 2*len(names))
+	for _, name := range names {
+		args = append(args, osc.String(name), osc.Float(params[name]))
+	}
+	return args
+}
+
+// score runs the score command
+func (c *controller) score() error {
+	fset := c.flagSets["score"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file or directory")
+	}
+	if *c.scoreEvents == "" {
+		return errors.New("expected -events")
+	}
+	entries := []libraryEntry{}
+	for _, path := range fset.Args() {
+		more, err := readSynthdefPath(path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, more...)
+	}
+	b, err := newScoreBuilder(entries)
+	if err != nil {
+		return err
+	}
+	events, err := readScoreEvents(*c.scoreEvents)
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if err := b.event(ev); err != nil {
+			return err
+		}
+	}
+	bundles, err := b.bundles(*c.scoreEnd)
+	if err != nil {
+		return err
+	}
+	if *c.scoreOut == "" {
+		return writeScore(os.Stdout, bundles)
+	}
+	return writeScoreFile(*c.scoreOut, bundles)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/osc"
+	"github.com/scgolang/sc"
+)
+
+// readScore reads the bundles of an NRT score.
+func readScore(r io.Reader) ([]osc.Bundle, error) {
+	bundles := []osc.Bundle{}
+	for {
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err == io.EOF {
+			return bundles, nil
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "reading length of bundle %d", len(bundles))
+		}
+		if size <= 0 {
+			return nil, errors.Errorf("bundle %d has length %d", len(bundles), size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, errors.Wrapf(err, "reading bundle %d", len(bundles))
+		}
+		b, err := osc.ParseBundle(data, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing bundle %d", len(bundles))
+		}
+		bundles = append(bundles, b)
+	}
+}
+
+// readScoreFile reads an NRT score file.
+func readScoreFile(path string) ([]osc.Bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	bundles, err := readScore(bufio.NewReader(f))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading "+path)
+	}
+	return bundles, nil
+}
+
+// scoreEntry is a command of an NRT score, as written by the score-dump command.
+type scoreEntry struct {
+	Time      float64       `json:"time"`
+	Address   string        `json:"address"`
+	Arguments []interface{} `json:"arguments"`
+	Synthdefs []string      `json:"synthdefs,omitempty"`
+	Warnings  []string      `json:"warnings,omitempty"`
+
+	message osc.Message
+}
+
+// scoreEntries flattens bundles and the bundles nested in them into commands in time order.
+func scoreEntries(bundles []osc.Bundle) []scoreEntry {
+	entries := []scoreEntry{}
+
+	var flatten func(b osc.Bundle)
+	flatten = func(b osc.Bundle) {
+		for _, p := range b.Packets {
+			switch p := p.(type) {
+			case osc.Message:
+				entries = append(entries, scoreEntry{
+					Time:      scoreSeconds(b.Timetag),
+					Address:   p.Address,
+					Arguments: argumentValues(p.Arguments),
+					message:   p,
+				})
+			case osc.Bundle:
+				flatten(p)
+			}
+		}
+	}
+	for _, b := range bundles {
+		flatten(b)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time < entries[j].Time })
+	return entries
+}
+
+// argumentValues returns the values of OSC arguments.
+// Blobs are replaced by a description of their size.
+func argumentValues(args []osc.Argument) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case osc.Int:
+			values[i] = int32(arg)
+		case osc.Float:
+			values[i] = float32(arg)
+		case osc.String:
+			values[i] = string(arg)
+		case osc.Blob:
+			values[i] = fmt.Sprintf("blob(%d bytes)", len(arg))
+		default:
+			values[i] = arg.String()
+		}
+	}
+	return values
+}
+
+// checkScore summarizes the synthdefs that the score loads and checks the controls of every
+// /s_new and /n_set against the params of the synthdef of the node.
+func checkScore(entries []scoreEntry) {
+	var (
+		defs  = map[string]*sc.Synthdef{}
+		nodes = map[int32]*sc.Synthdef{}
+	)
+	for i := range entries {
+		e := &entries[i]
+		args := e.message.Arguments
+
+		switch e.Address {
+		case synthdefRecvAddress:
+			if len(args) == 0 {
+				e.Warnings = append(e.Warnings, "missing synthdef data")
+				break
+			}
+			data, err := args[0].ReadBlob()
+			if err != nil {
+				e.Warnings = append(e.Warnings, "synthdef data is not a blob")
+				break
+			}
+			def, err := sc.ReadSynthdef(bytes.NewReader(data))
+			if err != nil {
+				e.Warnings = append(e.Warnings, "cannot read synthdef: "+err.Error())
+				break
+			}
+			defs[def.Name] = def
+			e.Synthdefs = append(e.Synthdefs, synthdefSummary(def))
+		case synthNewAddress:
+			if len(args) < 2 {
+				e.Warnings = append(e.Warnings, "expected a synthdef name and a node ID")
+				break
+			}
+			name, err1 := args[0].ReadString()
+			id, err2 := args[1].ReadInt32()
+			if err1 != nil || err2 != nil {
+				e.Warnings = append(e.Warnings, "expected a synthdef name and a node ID")
+				break
+			}
+			def, ok := defs[name]
+			if !ok {
+				e.Warnings = append(e.Warnings, fmt.Sprintf("synthdef %s is not loaded before this command", name))
+				break
+			}
+			nodes[id] = def
+			if len(args) > 4 {
+				e.Warnings = append(e.Warnings, checkControls(def, args[4:])...)
+			}
+		case nodeSetAddress:
+			if len(args) == 0 {
+				break
+			}
+			id, err := args[0].ReadInt32()
+			if err != nil {
+				break
+			}
+			if def, ok := nodes[id]; ok {
+				e.Warnings = append(e.Warnings, checkControls(def, args[1:])...)
+			}
+		case nodeFreeAddress:
+			for _, arg := range args {
+				if id, err := arg.ReadInt32(); err == nil {
+					delete(nodes, id)
+				}
+			}
+		}
+	}
+}
+
+// checkControls checks control name or index and value pairs against the params of a synthdef.
+func checkControls(def *sc.Synthdef, args []osc.Argument) []string {
+	warnings := []string{}
+	for i := 0; i < len(args); i += 2 {
+		if name, err := args[i].ReadString(); err == nil {
+			if !hasParam(def, name) {
+				warnings = append(warnings, fmt.Sprintf("%s has no param %s", def.Name, name))
+			}
+			continue
+		}
+		if idx, err := args[i].ReadInt32(); err == nil && (idx < 0 || int(idx) >= len(def.InitialParamValues)) {
+			warnings = append(warnings, fmt.Sprintf("%s has no param index %d", def.Name, idx))
+		}
+	}
+	if len(args)%2 != 0 {
+		warnings = append(warnings, "control without a value")
+	}
+	return warnings
+}
+
+// synthdefSummary describes a synthdef in a single line.
+func synthdefSummary(def *sc.Synthdef) string {
+	names := []string{}
+	for _, slice := range paramSlices(def) {
+		names = append(names, slice.Name)
+	}
+	return fmt.Sprintf("%s: %d ugens, %d constants, params (%s)", def.Name, len(def.Ugens), len(def.Constants), strings.Join(names, ", "))
+}
+
+// writeScoreEntries writes the commands of a score one per line.
+func writeScoreEntries(w io.Writer, entries []scoreEntry) error {
+	for _, e := range entries {
+		args := make([]string, len(e.Arguments))
+		for i, v := range e.Arguments {
+			args[i] = fmt.Sprint(v)
+		}
+		fmt.Fprintf(w, "%10.6f  %s %s\n", e.Time, e.Address, strings.Join(args, " "))
+		for _, summary := range e.Synthdefs {
+			fmt.Fprintf(w, "            %s\n", summary)
+		}
+		for _, warning := range e.Warnings {
+			fmt.Fprintf(w, "            warning: %s\n", warning)
+		}
+	}
+	return nil
+}
+
+// scoreDump runs the score-dump command
+func (c *controller) scoreDump() error {
+	fset := c.flagSets["score-dump"]
+
+	if fset.NArg() != 1 {
+		return errors.New("expected one score file")
+	}
+	bundles, err := readScoreFile(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	entries := scoreEntries(bundles)
+	checkScore(entries)
+
+	switch *c.scoreDumpOutput {
+	case "json":
+		return writeJSON(os.Stdout, entries)
+	case "text":
+		return writeScoreEntries(os.Stdout, entries)
+	default:
+		return errors.Errorf("unsupported output format %q", *c.scoreDumpOutput)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/osc"
+	"github.com/scgolang/sc"
+)
+
+// Defaults for talking to a running scsynth.
+const (
+	defaultScsynthAddr    = "127.0.0.1:57110"
+	defaultScsynthTimeout = 3 * time.Second
+)
+
+// maxDatagramSize is the largest UDP payload over IPv4.
+// Larger OSC packets cannot be sent to scsynth over UDP.
+const maxDatagramSize = 65507
+
+// OSC addresses of scsynth replies, and of the commands that only a running scsynth uses.
+const (
+	doneAddress         = "/done"
+	failAddress         = "/fail"
+	syncAddress         = "/sync"
+	syncedAddress       = "/synced"
+	synthdefLoadAddress = "/d_load"
+)
+
+// oscConn is a connection that OSC packets can be sent on.
+type oscConn interface {
+	Send(p osc.Packet) error
+	Close() error
+}
+
+// tcpConn sends OSC packets over TCP, where each packet is preceded by its length.
+type tcpConn struct {
+	net.Conn
+}
+
+// Send sends a packet.
+func (conn tcpConn) Send(p osc.Packet) error {
+	data := p.Bytes()
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err := conn.Write(frame)
+	return err
+}
+
+// serve reads packets and hands the replies to a handler until the connection closes.
+func (conn tcpConn) serve(handler osc.Method) error {
+	r := bufio.NewReader(conn)
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return err
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if len(data) == 0 || data[0] != '/' {
+			continue // Bundles are never replies.
+		}
+		msg, err := osc.ParseMessage(data, conn.RemoteAddr())
+		if err != nil {
+			return err
+		}
+		if msg.Address == doneAddress || msg.Address == failAddress || msg.Address == syncedAddress {
+			_ = handler(msg)
+		}
+	}
+}
+
+// scsynthClient sends commands to a running scsynth and waits for their replies.
+// Unlike sc.Client it listens for /fail as well as /done, and gives up after a timeout,
+// so a rejected synthdef or a missing server is reported instead of hanging.
+type scsynthClient struct {
+	addr    string
+	network string
+	conn    oscConn
+	replies chan osc.Message
+	timeout time.Duration
+
+	// LoadDir is a directory that scsynth can read, where sendDef writes synthdefs that
+	// are too big for a UDP datagram before loading them with /d_load. ServerDir is the
+	// same directory as scsynth sees it, if it is mounted somewhere else.
+	LoadDir   string
+	ServerDir string
+
+	// closed is closed when the connection stops receiving, and serveErr is the reason.
+	closed   chan struct{}
+	serveErr error
+}
+
+// dialScsynth creates a client for the scsynth at an address.
+// network is udp or tcp.
+func dialScsynth(network, addr string, timeout time.Duration) (*scsynthClient, error) {
+	c := &scsynthClient{
+		addr:    addr,
+		network: network,
+		replies: make(chan osc.Message, 16),
+		timeout: timeout,
+		closed:  make(chan struct{}),
+	}
+	reply := osc.Method(func(msg osc.Message) error {
+		select {
+		case c.replies <- msg:
+		default: // Nobody is waiting for this many replies.
+		}
+		return nil
+	})
+	switch network {
+	case "udp":
+		raddr, err := net.ResolveUDPAddr(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := osc.DialUDP(network, nil, raddr)
+		if err != nil {
+			return nil, errors.Wrap(err, "connecting to scsynth at "+addr)
+		}
+		c.conn = conn
+		go func() {
+			c.serveErr = conn.Serve(1, osc.Dispatcher{doneAddress: reply, failAddress: reply, syncedAddress: reply})
+			close(c.closed)
+		}()
+	case "tcp":
+		conn, err := net.DialTimeout(network, addr, timeout)
+		if err != nil {
+			return nil, errors.Wrap(err, "connecting to scsynth at "+addr)
+		}
+		tc := tcpConn{Conn: conn}
+		c.conn = tc
+		go func() {
+			c.serveErr = tc.serve(reply)
+			close(c.closed)
+		}()
+	default:
+		return nil, errors.Errorf("unsupported network %q, expected udp or tcp", network)
+	}
+	return c, nil
+}
+
+// close closes the connection.
+func (c *scsynthClient) close() error {
+	return c.conn.Close()
+}
+
+// send sends a command that has no reply.
+func (c *scsynthClient) send(msg osc.Message) error {
+	return errors.Wrap(c.conn.Send(msg), "sending "+msg.Address)
+}
+
+// call sends a command and waits for the /done or /fail reply to it.
+func (c *scsynthClient) call(msg osc.Message) error {
+	if err := c.send(msg); err != nil {
+		return err
+	}
+	return c.await(msg.Address, func(reply osc.Message) bool {
+		if reply.Address != doneAddress || len(reply.Arguments) == 0 {
+			return false
+		}
+		cmd, err := reply.Arguments[0].ReadString()
+		return err == nil && cmd == msg.Address
+	})
+}
+
+// sync waits until scsynth has run every command sent before it, and returns an error
+// if scsynth sent a /fail reply to cmd in the meantime. This is the only way to know
+// that commands without a /done reply, such as /s_new, succeeded.
+func (c *scsynthClient) sync(cmd string) error {
+	id := int32(time.Now().UnixNano() & 0x7FFFFFFF)
+	if err := c.send(osc.Message{Address: syncAddress, Arguments: []osc.Argument{osc.Int(id)}}); err != nil {
+		return err
+	}
+	return c.await(cmd, func(reply osc.Message) bool {
+		if reply.Address != syncedAddress || len(reply.Arguments) == 0 {
+			return false
+		}
+		synced, err := reply.Arguments[0].ReadInt32()
+		return err == nil && synced == id
+	})
+}
+
+// await waits for a reply that done accepts, or for a /fail reply to cmd.
+// Other replies, such as late replies to earlier commands, are skipped.
+func (c *scsynthClient) await(cmd string, done func(osc.Message) bool) error {
+	timeout := time.After(c.timeout)
+	for {
+		select {
+		case reply := <-c.replies:
+			if done(reply) {
+				return nil
+			}
+			if reply.Address != failAddress || len(reply.Arguments) == 0 {
+				continue
+			}
+			if failed, err := reply.Arguments[0].ReadString(); err != nil || failed != cmd {
+				continue
+			}
+			reason := "no reason given"
+			if len(reply.Arguments) > 1 {
+				if s, err := reply.Arguments[1].ReadString(); err == nil {
+					reason = s
+				}
+			}
+			return errors.Errorf("scsynth failed %s: %s", cmd, reason)
+		case <-c.closed:
+			if c.serveErr == nil {
+				return errors.New("connection to scsynth is closed")
+			}
+			return errors.Wrap(c.serveErr, "receiving from scsynth at "+c.addr)
+		case <-timeout:
+			return errors.Errorf("no reply to %s from scsynth at %s within %s", cmd, c.addr, c.timeout)
+		}
+	}
+}
+
+// sendDef loads a synthdef into scsynth and returns the command it used.
+// Synthdefs are sent with /d_recv, unless the message does not fit in a UDP datagram.
+// Then the synthdef is written to LoadDir and loaded from there with /d_load.
+func (c *scsynthClient) sendDef(def *sc.Synthdef) (string, error) {
+	data, err := synthdefBytes(def)
+	if err != nil {
+		return "", err
+	}
+	msg := osc.Message{
+		Address:   synthdefRecvAddress,
+		Arguments: []osc.Argument{osc.Blob(data)},
+	}
+	if size := len(msg.Bytes()); c.network == "udp" && size > maxDatagramSize {
+		if c.LoadDir == "" {
+			return "", errors.Errorf("%s is %d bytes, which is too big for a UDP datagram, use -load-dir or -tcp", def.Name, size)
+		}
+		return synthdefLoadAddress, c.loadDef(def)
+	}
+	return synthdefRecvAddress, c.call(msg)
+}
+
+// loadDef writes a synthdef to LoadDir and loads it with /d_load.
+// The synthdef name is the file name, so names that would put the file somewhere else are rejected,
+// and so are names with glob characters, since scsynth loads every file that matches the path.
+func (c *scsynthClient) loadDef(def *sc.Synthdef) error {
+	if def.Name == "" || strings.ContainsAny(def.Name, `/\*?[`) {
+		return errors.Errorf("cannot write synthdef %q to %s, its name is not a plain file name", def.Name, c.LoadDir)
+	}
+	file := def.Name + synthdefExt
+	if err := writeSynthdefFile(filepath.Join(c.LoadDir, file), def); err != nil {
+		return err
+	}
+	serverDir := c.ServerDir
+	if serverDir == "" {
+		serverDir = c.LoadDir
+	}
+	return c.call(osc.Message{
+		Address:   synthdefLoadAddress,
+		Arguments: []osc.Argument{osc.String(filepath.Join(serverDir, file))},
+	})
+}
+
+// synth creates a synth at the tail of the root node and waits until scsynth has created it.
+func (c *scsynthClient) synth(defName string, id int32, params map[string]float32) error {
+	args := []osc.Argument{osc.String(defName), osc.Int(id), osc.Int(sc.AddToTail), osc.Int(sc.RootNodeID)}
+	if err := c.send(osc.Message{Address: synthNewAddress, Arguments: append(args, controlArgs(params)...)}); err != nil {
+		return err
+	}
+	return c.sync(synthNewAddress)
+}
+
+// release releases a synth by setting its gate param to 0,
+// or frees it if its synthdef has no gate param.
+func (c *scsynthClient) release(def *sc.Synthdef, id int32) error {
+	if hasParam(def, gateParam) {
+		return c.send(osc.Message{
+			Address:   nodeSetAddress,
+			Arguments: append([]osc.Argument{osc.Int(id)}, controlArgs(map[string]float32{gateParam: 0})...),
+		})
+	}
+	return c.send(osc.Message{Address: nodeFreeAddress, Arguments: []osc.Argument{osc.Int(id)}})
+}
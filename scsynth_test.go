@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scgolang/osc"
+	"github.com/scgolang/sc"
+)
+
+// standInReply is how the stand-in scsynth replies to a /d_recv or /d_load of a synthdef.
+// Synthdefs named fail are rejected, synthdefs named silent get no reply, and every other
+// synthdef is loaded. /d_load reads the synthdef file, and fails if it cannot.
+func standInReply(msg osc.Message) (osc.Message, bool) {
+	if len(msg.Arguments) == 0 {
+		return osc.Message{}, false
+	}
+	var (
+		def *sc.Synthdef
+		err error
+	)
+	switch msg.Address {
+	case synthdefRecvAddress:
+		var data []byte
+		if data, err = msg.Arguments[0].ReadBlob(); err == nil {
+			def, err = sc.ReadSynthdef(bytes.NewReader(data))
+		}
+	case synthdefLoadAddress:
+		var path string
+		if path, err = msg.Arguments[0].ReadString(); err == nil {
+			def, err = readSynthdefFile(path)
+		}
+	default:
+		return osc.Message{}, false
+	}
+	if err != nil {
+		return osc.Message{Address: failAddress, Arguments: []osc.Argument{osc.String(msg.Address), osc.String(err.Error())}}, true
+	}
+	switch def.Name {
+	case "fail":
+		return osc.Message{Address: failAddress, Arguments: []osc.Argument{osc.String(msg.Address), osc.String("Command not allowed")}}, true
+	case "silent":
+		return osc.Message{}, false
+	}
+	return osc.Message{Address: doneAddress, Arguments: []osc.Argument{osc.String(msg.Address)}}, true
+}
+
+// startUDPStandIn starts a stand-in scsynth that listens on UDP and returns its address.
+func startUDPStandIn(t *testing.T) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			msg, err := osc.ParseMessage(buf[:n], from)
+			if err != nil {
+				continue
+			}
+			if reply, ok := standInReply(msg); ok {
+				_, _ = conn.WriteToUDP(reply.Bytes(), from)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// startTCPStandIn starts a stand-in scsynth that listens on TCP and returns its address.
+func startTCPStandIn(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveTCPStandIn(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// serveTCPStandIn replies to the length-prefixed packets of a TCP connection.
+func serveTCPStandIn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return
+		}
+		msg, err := osc.ParseMessage(data, conn.RemoteAddr())
+		if err != nil {
+			continue
+		}
+		if reply, ok := standInReply(msg); ok {
+			if err := (tcpConn{Conn: conn}).Send(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestSendDef(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		var addr string
+		if network == "udp" {
+			addr = startUDPStandIn(t)
+		} else {
+			addr = startTCPStandIn(t)
+		}
+		for _, tc := range []struct {
+			name    string
+			wantErr string
+		}{
+			{name: "done"},
+			{name: "fail", wantErr: "scsynth failed /d_recv: Command not allowed"},
+			{name: "silent", wantErr: "no reply to /d_recv"},
+		} {
+			t.Run(network+"/"+tc.name, func(t *testing.T) {
+				client, err := dialScsynth(network, addr, 200*time.Millisecond)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer func() { _ = client.close() }()
+
+				def := sc.NewSynthdef(tc.name, func(p sc.Params) sc.Ugen {
+					return sc.Out{Bus: sc.C(0), Channels: sc.SinOsc{}.Rate(sc.AR)}.Rate(sc.AR)
+				})
+				command, err := client.sendDef(def)
+				if command != synthdefRecvAddress {
+					t.Errorf("expected %s, got %q", synthdefRecvAddress, command)
+				}
+				if tc.wantErr == "" {
+					if err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+			})
+		}
+	}
+}
+
+func TestLoadDefRejectsPaths(t *testing.T) {
+	dir := t.TempDir()
+	client := &scsynthClient{LoadDir: filepath.Join(dir, "load")}
+	if err := os.Mkdir(client.LoadDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"../escaped", "sub/def", `sub\def`, "", "*", "def?", "[a-z]def"} {
+		def := sc.NewSynthdef(name, func(p sc.Params) sc.Ugen {
+			return sc.Out{Bus: sc.C(0), Channels: sc.SinOsc{}.Rate(sc.AR)}.Rate(sc.AR)
+		})
+		if err := client.loadDef(def); err == nil {
+			t.Errorf("expected an error for synthdef name %q", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped"+synthdefExt)); !os.IsNotExist(err) {
+		t.Fatalf("expected no synthdef file outside the load directory, got %v", err)
+	}
+}
+
+// bigSynthdef returns a synthdef that does not fit in a UDP datagram.
+func bigSynthdef(name string) *sc.Synthdef {
+	return sc.NewSynthdef(name, func(p sc.Params) sc.Ugen {
+		var sig sc.Input = sc.SinOsc{}.Rate(sc.AR)
+		for i := 0; i < 2500; i++ {
+			sig = sig.Add(sc.SinOsc{Freq: sc.C(float32(100 + i))}.Rate(sc.AR))
+		}
+		return sc.Out{Bus: sc.C(0), Channels: sig}.Rate(sc.AR)
+	})
+}
+
+func TestSendDefTooBigForUDP(t *testing.T) {
+	def := bigSynthdef("big")
+	if data, err := synthdefBytes(def); err != nil {
+		t.Fatal(err)
+	} else if len(data) <= maxDatagramSize {
+		t.Fatalf("expected a synthdef bigger than %d bytes, got %d", maxDatagramSize, len(data))
+	}
+	for _, tc := range []struct {
+		name        string
+		network     string
+		loadDir     bool
+		wantCommand string
+		wantErr     string
+	}{
+		{name: "udp without load dir", network: "udp", wantErr: "too big for a UDP datagram"},
+		{name: "udp with load dir", network: "udp", loadDir: true, wantCommand: synthdefLoadAddress},
+		{name: "tcp", network: "tcp", wantCommand: synthdefRecvAddress},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := startUDPStandIn(t)
+			if tc.network == "tcp" {
+				addr = startTCPStandIn(t)
+			}
+			client, err := dialScsynth(tc.network, addr, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = client.close() }()
+
+			if tc.loadDir {
+				client.LoadDir = t.TempDir()
+			}
+			command, err := client.sendDef(def)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if command != tc.wantCommand {
+				t.Errorf("expected %s, got %q", tc.wantCommand, command)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// sendResult is the result of loading a synthdef file into scsynth.
+type sendResult struct {
+	Path     string `json:"path"`
+	Synthdef string `json:"synthdef,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	// Command is the command that loaded the synthdef, /d_recv or /d_load,
+	// and Transport is the network it was sent over, udp or tcp.
+	Command   string `json:"command,omitempty"`
+	Transport string `json:"transport,omitempty"`
+}
+
+// sendSynthdefs loads the synthdefs of files and directories into scsynth.
+// A synthdef that cannot be read or loaded does not stop the others.
+func sendSynthdefs(client *scsynthClient, paths []string) []sendResult {
+	results := []sendResult{}
+	for _, path := range paths {
+		entries, err := readSynthdefPath(path)
+		if err != nil {
+			results = append(results, sendResult{Path: path, Error: err.Error()})
+			continue
+		}
+		for _, entry := range entries {
+			result := sendResult{Path: entry.Path, Synthdef: entry.Def.Name}
+			command, err := client.sendDef(entry.Def)
+			if err != nil {
+				result.Error = err.Error()
+			}
+			if command != "" {
+				result.Command, result.Transport = command, client.network
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// writeSendResults writes a line for every synthdef file.
+func writeSendResults(w io.Writer, results []sendResult) error {
+	for _, result := range results {
+		if result.Error != "" {
+			fmt.Fprintf(w, "FAIL  %s: %s\n", result.Path, result.Error)
+			continue
+		}
+		fmt.Fprintf(w, "ok    %s (%s) with %s over %s\n", result.Path, result.Synthdef, result.Command, result.Transport)
+	}
+	return nil
+}
+
+// send runs the send command
+func (c *controller) send() error {
+	fset := c.flagSets["send"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef file or directory")
+	}
+	network := "udp"
+	if *c.sendTCP {
+		network = "tcp"
+	}
+	client, err := dialScsynth(network, *c.sendAddr, *c.sendTimeout)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.close() }() // Best effort.
+
+	client.LoadDir, client.ServerDir = *c.sendLoadDir, *c.sendServerDir
+
+	results := sendSynthdefs(client, fset.Args())
+
+	switch *c.sendOutput {
+	case "json":
+		err = writeJSON(os.Stdout, results)
+	case "text":
+		err = writeSendResults(os.Stdout, results)
+	default:
+		err = errors.Errorf("unsupported output format %q", *c.sendOutput)
+	}
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d synthdef(s) failed to load", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// similarRounds is the number of Weisfeiler-Lehman relabeling rounds used to fingerprint a synthdef.
+// Each round extends the label of a ugen by one more level of its inputs.
+const similarRounds = 3
+
+// Kinds of similarity between two synthdefs, from most to least similar.
+const (
+	similarIdentical    = "identical"
+	similarSameTopology = "same topology, different constants"
+	similarSubgraph     = "subgraph"
+	similarNear         = "similar"
+)
+
+// fingerprint is a multiset of graph features.
+type fingerprint map[string]int
+
+// jaccard returns the weighted Jaccard similarity of two fingerprints,
+// i.e. the size of their intersection over the size of their union.
+func (fp fingerprint) jaccard(other fingerprint) float64 {
+	var intersection, union int
+	for feature, a := range fp {
+		b := other[feature]
+		intersection += minInt(a, b)
+		union += maxInt(a, b)
+	}
+	for feature, b := range other {
+		if _, ok := fp[feature]; !ok {
+			union += b
+		}
+	}
+	if union == 0 {
+		return 1
+	}
+	return float64(intersection) / float64(union)
+}
+
+// containedIn returns the fraction of the features of fp that also appear in other.
+func (fp fingerprint) containedIn(other fingerprint) float64 {
+	var intersection, size int
+	for feature, a := range fp {
+		intersection += minInt(a, other[feature])
+		size += a
+	}
+	if size == 0 {
+		return 1
+	}
+	return float64(intersection) / float64(size)
+}
+
+// synthdefFingerprint computes the Weisfeiler-Lehman fingerprint of a synthdef.
+// The label of a ugen starts as its name, rate, and special index, and every round
+// replaces it with a signature of the label and the labels of its inputs.
+// The fingerprint contains the labels of every ugen from every round.
+// Constant values are only part of the labels if withConstants is true.
+// Control ugens are labeled without their special index and output count,
+// so adding or reordering params changes as little as possible.
+func synthdefFingerprint(def *sc.Synthdef, withConstants bool) fingerprint {
+	var (
+		fp     = fingerprint{}
+		labels = make([]string, len(def.Ugens))
+	)
+	for i, u := range def.Ugens {
+		if _, ok := controlNames[u.Name]; ok {
+			labels[i] = fmt.Sprintf("%s/%d", u.Name, u.Rate)
+		} else {
+			labels[i] = fmt.Sprintf("%s/%d/%d/%d", u.Name, u.Rate, u.SpecialIndex, len(u.Outputs))
+		}
+		fp[labels[i]]++
+	}
+	for round := 0; round < similarRounds; round++ {
+		next := make([]string, len(def.Ugens))
+		for i, u := range def.Ugens {
+			inputs := make([]string, len(u.Inputs))
+			for ii, in := range u.Inputs {
+				switch {
+				case !in.IsConstant():
+					inputs[ii] = fmt.Sprintf("%s:%d", labels[in.UgenIndex], in.OutputIndex)
+				case withConstants:
+					inputs[ii] = fmt.Sprintf("c%08x", math.Float32bits(def.Constants[in.OutputIndex]))
+				default:
+					inputs[ii] = "c"
+				}
+			}
+			if isCommutative(u) {
+				sort.Strings(inputs)
+			}
+			next[i] = signature(labels[i], strings.Join(inputs, ","))
+			fp[next[i]]++
+		}
+		labels = next
+	}
+	return fp
+}
+
+// similarDef is a synthdef along with its fingerprints.
+type similarDef struct {
+	entry      libraryEntry
+	structural fingerprint
+	exact      fingerprint
+}
+
+// similarPair is a pair of similar synthdefs.
+type similarPair struct {
+	A     string  `json:"a"`
+	B     string  `json:"b"`
+	Score float64 `json:"score"`
+	Kind  string  `json:"kind"`
+}
+
+// similarCluster is a group of synthdefs connected by similar pairs.
+type similarCluster struct {
+	Files []string      `json:"files"`
+	Pairs []similarPair `json:"pairs"`
+}
+
+// compareSynthdefs compares two synthdefs and returns the kind of similarity, if any.
+// The score is the Jaccard similarity of the structural fingerprints.
+// A synthdef is a subgraph of another if all of its structural features appear in the other one.
+func compareSynthdefs(a, b similarDef, threshold float64) (similarPair, bool) {
+	pair := similarPair{A: a.entry.Path, B: b.entry.Path, Score: a.structural.jaccard(b.structural)}
+
+	switch {
+	case pair.Score == 1 && a.exact.jaccard(b.exact) == 1:
+		pair.Kind = similarIdentical
+	case pair.Score == 1:
+		pair.Kind = similarSameTopology
+	case a.structural.containedIn(b.structural) == 1 || b.structural.containedIn(a.structural) == 1:
+		pair.Kind = similarSubgraph
+	case pair.Score >= threshold:
+		pair.Kind = similarNear
+	default:
+		return pair, false
+	}
+	return pair, true
+}
+
+// findSimilar compares every pair of synthdefs and clusters the ones that are similar.
+// Clusters are the connected components of the similar pairs, and only contain more than one synthdef.
+func findSimilar(lib []libraryEntry, threshold float64) []similarCluster {
+	var (
+		defs   = make([]similarDef, len(lib))
+		parent = make([]int, len(lib))
+		pairs  = map[int][]similarPair{}
+		find   func(i int) int
+	)
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i, entry := range lib {
+		defs[i] = similarDef{
+			entry:      entry,
+			structural: synthdefFingerprint(entry.Def, false),
+			exact:      synthdefFingerprint(entry.Def, true),
+		}
+		parent[i] = i
+	}
+	found := map[int][]similarPair{}
+	for i := range defs {
+		for j := i + 1; j < len(defs); j++ {
+			if pair, ok := compareSynthdefs(defs[i], defs[j], threshold); ok {
+				found[i] = append(found[i], pair)
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+	for i, ps := range found {
+		root := find(i)
+		pairs[root] = append(pairs[root], ps...)
+	}
+	clusters := []similarCluster{}
+	for i := range defs {
+		if find(i) != i || len(pairs[i]) == 0 {
+			continue
+		}
+		cluster := similarCluster{Pairs: pairs[i]}
+		for j := range defs {
+			if find(j) == i {
+				cluster.Files = append(cluster.Files, defs[j].entry.Path)
+			}
+		}
+		sort.Slice(cluster.Pairs, func(a, b int) bool {
+			pa, pb := cluster.Pairs[a], cluster.Pairs[b]
+			if pa.Score != pb.Score {
+				return pa.Score > pb.Score
+			}
+			return pa.A+"\x00"+pa.B < pb.A+"\x00"+pb.B
+		})
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(a, b int) bool { return clusters[a].Files[0] < clusters[b].Files[0] })
+	return clusters
+}
+
+// similar runs the similar command
+func (c *controller) similar() error {
+	fset := c.flagSets["similar"]
+
+	if fset.NArg() == 0 {
+		return errors.New("expected at least one synthdef directory or file")
+	}
+	if *c.similarThreshold < 0 || *c.similarThreshold > 1 {
+		return errors.New("threshold must be between 0 and 1")
+	}
+	lib := []libraryEntry{}
+	for _, path := range fset.Args() {
+		entries, err := readSynthdefPath(path)
+		if err != nil {
+			return err
+		}
+		lib = append(lib, entries...)
+	}
+	clusters := findSimilar(lib, *c.similarThreshold)
+
+	switch *c.similarOutput {
+	case "json":
+		return writeJSON(os.Stdout, clusters)
+	case "text":
+		return writeSimilar(os.Stdout, clusters)
+	default:
+		return errors.Errorf("unsupported output format %q", *c.similarOutput)
+	}
+}
+
+// writeSimilar writes a human-readable list of clusters.
+func writeSimilar(w io.Writer, clusters []similarCluster) error {
+	for i, cluster := range clusters {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "cluster %d (%d synthdefs)\n", i+1, len(cluster.Files))
+		for _, pair := range cluster.Pairs {
+			fmt.Fprintf(w, "  %.2f  %s  %s  %s\n", pair.Score, pair.A, pair.B, pair.Kind)
+		}
+	}
+	return nil
+}
+
+// minInt returns the smaller of two ints.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger of two ints.
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// readSynthdefFile reads a synthdef from a file.
+func readSynthdefFile(path string) (*sc.Synthdef, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	def, err := sc.ReadSynthdef(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading "+path)
+	}
+	return def, nil
+}
+
+// synthdefExt is the file extension of synthdef files.
+const synthdefExt = ".scsyndef"
+
+// libraryEntry is a synthdef that was read from a directory.
+type libraryEntry struct {
+	Path string
+	Def  *sc.Synthdef
+}
+
+// readSynthdefDir reads all the synthdef files in a directory.
+// Entries are sorted by file name.
+func readSynthdefDir(dir string) ([]libraryEntry, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+synthdefExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	entries := make([]libraryEntry, len(paths))
+	for i, path := range paths {
+		def, err := readSynthdefFile(path)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = libraryEntry{Path: path, Def: def}
+	}
+	return entries, nil
+}
+
+// readSynthdefPath reads a synthdef file, or all the synthdef files in a directory.
+func readSynthdefPath(path string) ([]libraryEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return readSynthdefDir(path)
+	}
+	def, err := readSynthdefFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []libraryEntry{{Path: path, Def: def}}, nil
+}
+
+// paramValue returns the value of a param for a synth instance.
+// overrides maps param names to values, and takes precedence over
+// the initial value of the param.
+func paramValue(def *sc.Synthdef, idx int32, overrides map[string]float32) float32 {
+	if v, ok := overrides[paramName(def, idx)]; ok {
+		return v
+	}
+	if idx < 0 || int(idx) >= len(def.InitialParamValues) {
+		return 0
+	}
+	return def.InitialParamValues[idx]
+}
+
+// resolveInput returns the value of a ugen input if it is a constant or a param.
+// The second return value is false if the input is computed by another ugen.
+func resolveInput(def *sc.Synthdef, src inputSource, overrides map[string]float32) (float32, bool) {
+	switch src.Kind {
+	case sourceConstant:
+		return src.Value, true
+	case sourceParam:
+		return paramValue(def, src.ParamIndex, overrides), true
+	}
+	return 0, false
+}
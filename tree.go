@@ -7,30 +7,85 @@ import (
 	"github.com/scgolang/sc"
 )
 
-func (c *controller) writeTree(w io.Writer, d *sc.Synthdef) error {
-	return tree(d, d.Root(), "")
+func (c *controller) writeTree(w io.Writer, d *sc.Synthdef, cat ugenCatalog) error {
+	controls := newControlModel(d)
+	for _, root := range treeRoots(d) {
+		if err := tree(w, d, controls, cat, root, ""); err != nil {
+			return err
+		}
+	}
+	for _, problem := range cat.checkSynthdef(d) {
+		fmt.Fprintf(w, "warning: %s\n", problem)
+	}
+	return nil
+}
+
+// treeRoots returns the indices of the ugens whose outputs are not consumed by any other ugen.
+// Control ugens are skipped since unused params would otherwise show up as roots.
+func treeRoots(d *sc.Synthdef) []int32 {
+	consumed := make([]bool, len(d.Ugens))
+	for _, u := range d.Ugens {
+		for _, in := range u.Inputs {
+			if !in.IsConstant() {
+				consumed[in.UgenIndex] = true
+			}
+		}
+	}
+	roots := []int32{}
+	for i, u := range d.Ugens {
+		if _, ok := controlNames[u.Name]; ok || consumed[i] {
+			continue
+		}
+		roots = append(roots, int32(i))
+	}
+	return roots
 }
 
-func tree(s *sc.Synthdef, ugenIndex int32, prefix string) error {
+func tree(w io.Writer, s *sc.Synthdef, controls *controlModel, cat ugenCatalog, ugenIndex int32, prefix string) error {
 	u := s.Ugens[ugenIndex]
 
-	fmt.Printf("%s(%d)\n", u.Name, ugenIndex)
+	if op := operatorName(u); op != "" {
+		fmt.Fprintf(w, "%s(%d) %s\n", u.Name, ugenIndex, op)
+	} else {
+		fmt.Fprintf(w, "%s(%d)\n", u.Name, ugenIndex)
+	}
 
 	for i, in := range u.Inputs {
 		if i == len(u.Inputs)-1 {
-			fmt.Printf(prefix + "\u2514\u2500\u2500 ")
+			fmt.Fprint(w, prefix+"\u2514\u2500\u2500 ")
 		} else {
-			fmt.Printf(prefix + "\u251c\u2500\u2500 ")
+			fmt.Fprint(w, prefix+"\u251c\u2500\u2500 ")
 		}
+		fmt.Fprint(w, cat.inputName(u, i)+": ")
 		if in.IsConstant() {
-			fmt.Printf("%f\n", s.Constants[in.OutputIndex])
+			fmt.Fprintf(w, "%f\n", s.Constants[in.OutputIndex])
+			continue
+		}
+		if pc, ok := controls.lookup(in.UgenIndex, in.OutputIndex); ok {
+			fmt.Fprintf(w, "%s(%d) %s\n", pc.Control, pc.UgenIndex, describeControl(pc))
 			continue
 		}
 		if i == len(u.Inputs)-1 {
-			tree(s, in.UgenIndex, prefix+"    ")
+			tree(w, s, controls, cat, in.UgenIndex, prefix+"    ")
 		} else {
-			tree(s, in.UgenIndex, prefix+"\u2502   ")
+			tree(w, s, controls, cat, in.UgenIndex, prefix+"\u2502   ")
 		}
 	}
 	return nil
 }
+
+// describeControl returns the param name, rate, and lag of a param control,
+// e.g. "freqs[1] (control rate, default 220)".
+func describeControl(pc paramControl) string {
+	name := pc.Name
+	if name == "" {
+		name = fmt.Sprintf("#%d", pc.Index)
+	} else if pc.Length != 1 {
+		name = fmt.Sprintf("%s[%d]", pc.Name, pc.Offset)
+	}
+	s := fmt.Sprintf("%s (%s rate, default %g", name, pc.Rate, pc.Default)
+	if pc.Lag != 0 {
+		s += fmt.Sprintf(", lag %g", pc.Lag)
+	}
+	return s + ")"
+}
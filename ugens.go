@@ -0,0 +1,659 @@
+package main
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// Envelope segment shapes, as numbered in the inputs of EnvGen.
+// See the Curve constants of the sc package.
+const (
+	envShapeStep    = 0
+	envShapeLinear  = 1
+	envShapeExp     = 2
+	envShapeSine    = 3
+	envShapeWelch   = 4
+	envShapeCustom  = 5
+	envShapeSquared = 6
+	envShapeCubed   = 7
+	envShapeHold    = 8
+)
+
+// renderUgens contains the ugens the renderer can run.
+var renderUgens = map[string]unitBuilder{
+	"AudioControl": newControlUnit,
+	"BinaryOpUGen": newBinaryOpUnit,
+	"Control":      newControlUnit,
+	"EnvGen":       newEnvGenUnit,
+	"HPF":          newButterworthUnit,
+	"LFPulse":      newPulseUnit,
+	"LFSaw":        newSawUnit,
+	"LPF":          newButterworthUnit,
+	"LagControl":   newControlUnit,
+	"Line":         newLineUnit,
+	"MulAdd":       newMulAddUnit,
+	"Out":          newOutUnit,
+	"Pan2":         newPan2Unit,
+	"Pulse":        newPulseUnit,
+	"RLPF":         newRLPFUnit,
+	"Saw":          newSawUnit,
+	"SinOsc":       newSinOscUnit,
+	"TrigControl":  newControlUnit,
+	"UnaryOpUGen":  newUnaryOpUnit,
+	"WhiteNoise":   newWhiteNoiseUnit,
+	"XLine":        newLineUnit,
+}
+
+// controlUnit outputs the current values of the params of a control ugen.
+// Lags are ignored. A TrigControl resets its params to 0 once it has output them.
+type controlUnit struct {
+	r     *renderer
+	index int
+	out   []signal
+	trig  bool
+}
+
+func newControlUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	return &controlUnit{r: r, index: int(u.SpecialIndex), out: r.outputs[idx], trig: u.Name == "TrigControl"}, nil
+}
+
+func (cu *controlUnit) next(n int) {
+	for oi, out := range cu.out {
+		p := cu.index + oi
+		if p >= len(cu.r.params) {
+			continue
+		}
+		for i := 0; i < n; i++ {
+			out[i] = cu.r.params[p]
+		}
+		if cu.trig {
+			cu.r.params[p] = 0
+		}
+	}
+}
+
+// sinOscUnit is a sine oscillator.
+type sinOscUnit struct {
+	freq, phase, out signal
+	sr, pos          float64
+}
+
+func newSinOscUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	return &sinOscUnit{freq: r.input(u, 0), phase: r.input(u, 1), out: r.outputs[idx][0], sr: r.sampleRate(u.Rate)}, nil
+}
+
+func (o *sinOscUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		o.out[i] = float32(math.Sin(o.pos + float64(o.phase.at(i))))
+		o.pos = math.Mod(o.pos+2*math.Pi*float64(o.freq.at(i))/o.sr, 2*math.Pi)
+	}
+}
+
+// sawUnit is a sawtooth from -1 to 1, used for both Saw and LFSaw.
+// It is not band-limited.
+type sawUnit struct {
+	freq, out signal
+	sr, phase float64
+}
+
+func newSawUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	o := &sawUnit{freq: r.input(u, 0), out: r.outputs[idx][0], sr: r.sampleRate(u.Rate)}
+	if u.Name == "LFSaw" {
+		o.phase = float64(r.input(u, 1).at(0))
+	}
+	return o, nil
+}
+
+func (o *sawUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		o.out[i] = float32(o.phase)
+		o.phase += 2 * float64(o.freq.at(i)) / o.sr
+		if o.phase >= 1 || o.phase < -1 {
+			o.phase -= 2 * math.Floor((o.phase+1)/2)
+		}
+	}
+}
+
+// pulseUnit is a pulse wave, used for both Pulse (from -1 to 1) and LFPulse (from 0 to 1).
+// It is not band-limited.
+type pulseUnit struct {
+	freq, width, out signal
+	sr, phase        float64
+	low              float32
+}
+
+func newPulseUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	o := &pulseUnit{freq: r.input(u, 0), width: r.input(u, 1), out: r.outputs[idx][0], sr: r.sampleRate(u.Rate), low: -1}
+	if u.Name == "LFPulse" {
+		o.phase = float64(r.input(u, 1).at(0))
+		o.width = r.input(u, 2)
+		o.low = 0
+	}
+	return o, nil
+}
+
+func (o *pulseUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		if o.phase < float64(o.width.at(i)) {
+			o.out[i] = 1
+		} else {
+			o.out[i] = o.low
+		}
+		o.phase += float64(o.freq.at(i)) / o.sr
+		o.phase -= math.Floor(o.phase)
+	}
+}
+
+// whiteNoiseUnit is uniform noise from -1 to 1.
+type whiteNoiseUnit struct {
+	r   *renderer
+	out signal
+}
+
+func newWhiteNoiseUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	return &whiteNoiseUnit{r: r, out: r.outputs[idx][0]}, nil
+}
+
+func (o *whiteNoiseUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		o.out[i] = o.r.rng.Float32()*2 - 1
+	}
+}
+
+// butterworthUnit is the second order Butterworth filter of LPF and HPF,
+// with the coefficients scsynth uses.
+type butterworthUnit struct {
+	in, freq, out signal
+	sr, y1, y2    float64
+	highPass      bool
+}
+
+func newButterworthUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	return &butterworthUnit{in: r.input(u, 0), freq: r.input(u, 1), out: r.outputs[idx][0], sr: r.sampleRate(u.Rate), highPass: u.Name == "HPF"}, nil
+}
+
+func (f *butterworthUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		var (
+			pfreq = math.Pi * clampFreq(float64(f.freq.at(i)), f.sr) / f.sr
+			c     = 1 / math.Tan(pfreq)
+			sign  = -1.0
+		)
+		if f.highPass {
+			c, sign = math.Tan(pfreq), 1
+		}
+		var (
+			c2     = c * c
+			sqrt2C = c * math.Sqrt2
+			a0     = 1 / (1 + sqrt2C + c2)
+			b1     = sign * 2 * (1 - c2) * a0
+			b2     = -(1 - sqrt2C + c2) * a0
+			y0     = float64(f.in.at(i)) + b1*f.y1 + b2*f.y2
+		)
+		f.out[i] = float32(a0 * (y0 - sign*2*f.y1 + f.y2))
+		f.y2, f.y1 = f.y1, y0
+	}
+}
+
+// rlpfUnit is a resonant low pass filter, with the coefficients scsynth uses.
+type rlpfUnit struct {
+	in, freq, rq, out signal
+	sr, y1, y2        float64
+}
+
+func newRLPFUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	return &rlpfUnit{in: r.input(u, 0), freq: r.input(u, 1), rq: r.input(u, 2), out: r.outputs[idx][0], sr: r.sampleRate(u.Rate)}, nil
+}
+
+func (f *rlpfUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		var (
+			pfreq = 2 * math.Pi * clampFreq(float64(f.freq.at(i)), f.sr) / f.sr
+			qres  = math.Max(0.001, float64(f.rq.at(i)))
+			d     = math.Tan(pfreq * qres * 0.5)
+			c     = (1 - d) / (1 + d)
+			b1    = (1 + c) * math.Cos(pfreq)
+			b2    = -c
+			a0    = (1 + c - b1) * 0.25
+			y0    = a0*float64(f.in.at(i)) + b1*f.y1 + b2*f.y2
+		)
+		f.out[i] = float32(y0 + 2*f.y1 + f.y2)
+		f.y2, f.y1 = f.y1, y0
+	}
+}
+
+// clampFreq keeps a filter frequency between 0 and the Nyquist frequency, exclusive.
+func clampFreq(freq, sr float64) float64 {
+	return math.Min(math.Max(freq, 0.01), sr*0.4999)
+}
+
+// envGenUnit is a breakpoint envelope. See sc.Env for the layout of its envelope inputs.
+// A gate that opens starts the envelope from its first segment, and a gate that closes
+// jumps to the release node. While the gate is open, the envelope holds at the release node,
+// or loops back to the loop node if there is one.
+type envGenUnit struct {
+	r                                      *renderer
+	gate, levelScale, levelBias, timeScale signal
+	doneAction, out                        signal
+	env                                    []signal
+	sr                                     float64
+	stage, counter, length                 int
+	level, start                           float64
+	prevGate                               float32
+	holding, done                          bool
+}
+
+func newEnvGenUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	if len(u.Inputs) < 9 {
+		return nil, errors.New("envelope has no segments")
+	}
+	e := &envGenUnit{
+		r:          r,
+		gate:       r.input(u, 0),
+		levelScale: r.input(u, 1),
+		levelBias:  r.input(u, 2),
+		timeScale:  r.input(u, 3),
+		doneAction: r.input(u, 4),
+		out:        r.outputs[idx][0],
+		sr:         r.sampleRate(u.Rate),
+		stage:      -1,
+	}
+	for i := 5; i < len(u.Inputs); i++ {
+		e.env = append(e.env, r.input(u, i))
+	}
+	if need := 4 + 4*e.numStages(); len(e.env) < need {
+		return nil, errors.Errorf("envelope has %d inputs, expected %d", len(e.env), need)
+	}
+	e.level = e.envAt(0)
+	return e, nil
+}
+
+// envAt returns an input of the envelope.
+func (e *envGenUnit) envAt(i int) float64 {
+	return float64(e.env[i].at(0))
+}
+
+func (e *envGenUnit) numStages() int   { return int(e.envAt(1)) }
+func (e *envGenUnit) releaseNode() int { return int(e.envAt(2)) }
+func (e *envGenUnit) loopNode() int    { return int(e.envAt(3)) }
+
+// startStage starts a segment of the envelope from the current level.
+func (e *envGenUnit) startStage(stage int) {
+	e.stage, e.start, e.counter = stage, e.level, 0
+	e.holding, e.done = false, false
+	e.length = int(math.Max(1, math.Floor(e.envAt(5+4*stage)*float64(e.timeScale.at(0))*e.sr+0.5)))
+}
+
+// endStage moves on from a segment of the envelope that has finished.
+func (e *envGenUnit) endStage() {
+	next := e.stage + 1
+	switch {
+	case next >= e.numStages():
+		e.done = true
+		e.r.doneAction(e.doneAction.at(0))
+	case next == e.releaseNode() && e.prevGate > 0:
+		if loop := e.loopNode(); loop >= 0 && loop < next {
+			e.startStage(loop)
+		} else {
+			e.holding = true
+		}
+	default:
+		e.startStage(next)
+	}
+}
+
+func (e *envGenUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		gate := e.gate.at(i)
+		switch release := e.releaseNode(); {
+		case gate > 0 && e.prevGate <= 0:
+			e.prevGate = gate
+			e.startStage(0)
+		case gate <= 0 && e.prevGate > 0 && release >= 0 && release < e.numStages() && e.stage < release && !e.done:
+			e.prevGate = gate
+			e.startStage(release)
+		default:
+			e.prevGate = gate
+		}
+		e.out[i] = float32(e.level*float64(e.levelScale.at(i)) + float64(e.levelBias.at(i)))
+
+		if e.stage < 0 || e.holding || e.done {
+			continue
+		}
+		e.counter++
+		k := 4 + 4*e.stage
+		end := e.envAt(k)
+		e.level = envLevel(int(e.envAt(k+2)), e.envAt(k+3), e.start, end, float64(e.counter)/float64(e.length))
+		if e.counter >= e.length {
+			e.level = end
+			e.endStage()
+		}
+	}
+}
+
+// envLevel returns the level of an envelope segment at a position from 0 to 1.
+func envLevel(shape int, curve, start, end, pos float64) float64 {
+	switch shape {
+	case envShapeStep:
+		return end
+	case envShapeHold:
+		if pos < 1 {
+			return start
+		}
+		return end
+	case envShapeExp:
+		if start == 0 || end == 0 || (start > 0) != (end > 0) {
+			break
+		}
+		return start * math.Pow(end/start, pos)
+	case envShapeSine:
+		return start + (end-start)*(0.5-0.5*math.Cos(math.Pi*pos))
+	case envShapeWelch:
+		if start < end {
+			return start + (end-start)*math.Sin(math.Pi/2*pos)
+		}
+		return end + (start-end)*math.Sin(math.Pi/2*(1-pos))
+	case envShapeCustom:
+		if math.Abs(curve) < 0.0001 {
+			break
+		}
+		return start + (end-start)*(1-math.Exp(pos*curve))/(1-math.Exp(curve))
+	case envShapeSquared:
+		s, e := math.Sqrt(start), math.Sqrt(end)
+		x := s + (e-s)*pos
+		return x * x
+	case envShapeCubed:
+		s, e := math.Cbrt(start), math.Cbrt(end)
+		x := s + (e-s)*pos
+		return x * x * x
+	}
+	return start + (end-start)*pos
+}
+
+// lineUnit is a linear (Line) or exponential (XLine) ramp.
+// Its start, end, and duration are read once when the synth starts.
+type lineUnit struct {
+	r                 *renderer
+	doneAction, out   signal
+	start, end        float64
+	counter, length   int
+	exponential, done bool
+}
+
+func newLineUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	l := &lineUnit{
+		r:          r,
+		doneAction: r.input(u, 3),
+		out:        r.outputs[idx][0],
+		start:      float64(r.input(u, 0).at(0)),
+		end:        float64(r.input(u, 1).at(0)),
+		length:     int(math.Max(1, math.Floor(float64(r.input(u, 2).at(0))*r.sampleRate(u.Rate)+0.5))),
+	}
+	if u.Name == "XLine" {
+		l.exponential = true
+		if l.start == 0 || l.end == 0 || (l.start > 0) != (l.end > 0) {
+			return nil, errors.New("start and end must be non-zero and have the same sign")
+		}
+	}
+	return l, nil
+}
+
+func (l *lineUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		pos := float64(l.counter) / float64(l.length)
+		if l.exponential {
+			l.out[i] = float32(l.start * math.Pow(l.end/l.start, pos))
+		} else {
+			l.out[i] = float32(l.start + (l.end-l.start)*pos)
+		}
+		if l.counter < l.length {
+			l.counter++
+		} else if !l.done {
+			l.done = true
+			l.r.doneAction(l.doneAction.at(0))
+		}
+	}
+}
+
+// binaryOpFuncs contains the BinaryOpUGen operators the renderer supports.
+var binaryOpFuncs = map[string]func(a, b float64) float64{
+	"+":        func(a, b float64) float64 { return a + b },
+	"-":        func(a, b float64) float64 { return a - b },
+	"*":        func(a, b float64) float64 { return a * b },
+	"/":        func(a, b float64) float64 { return a / b },
+	"div":      func(a, b float64) float64 { return math.Floor(a / b) },
+	"mod":      func(a, b float64) float64 { return a - b*math.Floor(a/b) },
+	"==":       func(a, b float64) float64 { return boolFloat(a == b) },
+	"!=":       func(a, b float64) float64 { return boolFloat(a != b) },
+	"<":        func(a, b float64) float64 { return boolFloat(a < b) },
+	">":        func(a, b float64) float64 { return boolFloat(a > b) },
+	"<=":       func(a, b float64) float64 { return boolFloat(a <= b) },
+	">=":       func(a, b float64) float64 { return boolFloat(a >= b) },
+	"min":      math.Min,
+	"max":      math.Max,
+	"round":    func(a, b float64) float64 { return roundTo(a, b, math.Floor, 0.5) },
+	"roundUp":  func(a, b float64) float64 { return roundTo(a, b, math.Ceil, 0) },
+	"trunc":    func(a, b float64) float64 { return roundTo(a, b, math.Floor, 0) },
+	"atan2":    math.Atan2,
+	"hypot":    math.Hypot,
+	"hypotApx": math.Hypot,
+	"pow":      func(a, b float64) float64 { return math.Copysign(math.Pow(math.Abs(a), b), a) },
+	"ring1":    func(a, b float64) float64 { return a*b + a },
+	"ring2":    func(a, b float64) float64 { return a*b + a + b },
+	"ring3":    func(a, b float64) float64 { return a * a * b },
+	"ring4":    func(a, b float64) float64 { return a*a*b - a*b*b },
+	"difsqr":   func(a, b float64) float64 { return a*a - b*b },
+	"sumsqr":   func(a, b float64) float64 { return a*a + b*b },
+	"sqrsum":   func(a, b float64) float64 { return (a + b) * (a + b) },
+	"sqrdif":   func(a, b float64) float64 { return (a - b) * (a - b) },
+	"absdif":   func(a, b float64) float64 { return math.Abs(a - b) },
+	"thresh":   func(a, b float64) float64 { return a * boolFloat(a >= b) },
+	"amclip":   func(a, b float64) float64 { return a * b * boolFloat(b > 0) },
+	"scaleneg": func(a, b float64) float64 { return math.Min(a, 0)*b + math.Max(a, 0) },
+	"clip2":    func(a, b float64) float64 { return math.Min(math.Max(a, -b), b) },
+	"excess":   func(a, b float64) float64 { return a - math.Min(math.Max(a, -b), b) },
+	"fold2":    func(a, b float64) float64 { return fold(a, -b, b) },
+	"wrap2":    func(a, b float64) float64 { return wrap(a, -b, b) },
+	"firstArg": func(a, b float64) float64 { return a },
+}
+
+// unaryOpFuncs contains the UnaryOpUGen operators the renderer supports.
+var unaryOpFuncs = map[string]func(a float64) float64{
+	"neg":        func(a float64) float64 { return -a },
+	"not":        func(a float64) float64 { return boolFloat(a <= 0) },
+	"abs":        math.Abs,
+	"asFloat":    func(a float64) float64 { return a },
+	"asInt":      math.Trunc,
+	"ceil":       math.Ceil,
+	"floor":      math.Floor,
+	"frac":       func(a float64) float64 { return a - math.Floor(a) },
+	"sign":       func(a float64) float64 { return boolFloat(a > 0) - boolFloat(a < 0) },
+	"squared":    func(a float64) float64 { return a * a },
+	"cubed":      func(a float64) float64 { return a * a * a },
+	"sqrt":       func(a float64) float64 { return math.Copysign(math.Sqrt(math.Abs(a)), a) },
+	"exp":        math.Exp,
+	"reciprocal": func(a float64) float64 { return 1 / a },
+	"midicps":    func(a float64) float64 { return 440 * math.Pow(2, (a-69)/12) },
+	"cpsmidi":    func(a float64) float64 { return 12*math.Log2(a/440) + 69 },
+	"midiratio":  func(a float64) float64 { return math.Pow(2, a/12) },
+	"ratiomidi":  func(a float64) float64 { return 12 * math.Log2(a) },
+	"dbamp":      func(a float64) float64 { return math.Pow(10, a/20) },
+	"ampdb":      func(a float64) float64 { return 20 * math.Log10(a) },
+	"octcps":     func(a float64) float64 { return 440 * math.Pow(2, a-4.75) },
+	"cpsoct":     func(a float64) float64 { return math.Log2(a/440) + 4.75 },
+	"log":        math.Log,
+	"log2":       math.Log2,
+	"log10":      math.Log10,
+	"sin":        math.Sin,
+	"cos":        math.Cos,
+	"tan":        math.Tan,
+	"asin":       math.Asin,
+	"acos":       math.Acos,
+	"atan":       math.Atan,
+	"sinh":       math.Sinh,
+	"cosh":       math.Cosh,
+	"tanh":       math.Tanh,
+	"distort":    func(a float64) float64 { return a / (1 + math.Abs(a)) },
+	"softclip": func(a float64) float64 {
+		if math.Abs(a) <= 0.5 {
+			return a
+		}
+		return (math.Abs(a) - 0.25) / a
+	},
+	"silence": func(a float64) float64 { return 0 },
+	"thru":    func(a float64) float64 { return a },
+}
+
+// boolFloat returns 1 for true and 0 for false.
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// roundTo rounds a to a multiple of b with a rounding function, after adding offset.
+func roundTo(a, b float64, round func(float64) float64, offset float64) float64 {
+	if b == 0 {
+		return a
+	}
+	return round(a/b+offset) * b
+}
+
+// fold folds a value back and forth between lo and hi.
+func fold(x, lo, hi float64) float64 {
+	r := hi - lo
+	if r <= 0 {
+		return lo
+	}
+	x = math.Mod(x-lo, 2*r)
+	if x < 0 {
+		x += 2 * r
+	}
+	if x > r {
+		x = 2*r - x
+	}
+	return x + lo
+}
+
+// wrap wraps a value around between lo and hi.
+func wrap(x, lo, hi float64) float64 {
+	r := hi - lo
+	if r <= 0 {
+		return lo
+	}
+	return x - r*math.Floor((x-lo)/r)
+}
+
+// binaryOpUnit applies a binary operator.
+type binaryOpUnit struct {
+	a, b, out signal
+	fn        func(a, b float64) float64
+}
+
+func newBinaryOpUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	fn, ok := binaryOpFuncs[operatorName(u)]
+	if !ok {
+		return nil, errors.Errorf("operator %s is not supported", operatorName(u))
+	}
+	return &binaryOpUnit{a: r.input(u, 0), b: r.input(u, 1), out: r.outputs[idx][0], fn: fn}, nil
+}
+
+func (o *binaryOpUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		o.out[i] = float32(o.fn(float64(o.a.at(i)), float64(o.b.at(i))))
+	}
+}
+
+// unaryOpUnit applies a unary operator.
+type unaryOpUnit struct {
+	a, out signal
+	fn     func(a float64) float64
+}
+
+func newUnaryOpUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	fn, ok := unaryOpFuncs[operatorName(u)]
+	if !ok {
+		return nil, errors.Errorf("operator %s is not supported", operatorName(u))
+	}
+	return &unaryOpUnit{a: r.input(u, 0), out: r.outputs[idx][0], fn: fn}, nil
+}
+
+func (o *unaryOpUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		o.out[i] = float32(o.fn(float64(o.a.at(i))))
+	}
+}
+
+// mulAddUnit computes in * mul + add.
+type mulAddUnit struct {
+	in, mul, add, out signal
+}
+
+func newMulAddUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	return &mulAddUnit{in: r.input(u, 0), mul: r.input(u, 1), add: r.input(u, 2), out: r.outputs[idx][0]}, nil
+}
+
+func (o *mulAddUnit) next(n int) {
+	for i := 0; i < n; i++ {
+		o.out[i] = o.in.at(i)*o.mul.at(i) + o.add.at(i)
+	}
+}
+
+// pan2Unit is an equal power stereo panner.
+type pan2Unit struct {
+	in, pos, level, left, right signal
+}
+
+func newPan2Unit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	if len(u.Outputs) != 2 {
+		return nil, errors.Errorf("expected 2 outputs, got %d", len(u.Outputs))
+	}
+	return &pan2Unit{in: r.input(u, 0), pos: r.input(u, 1), level: r.input(u, 2), left: r.outputs[idx][0], right: r.outputs[idx][1]}, nil
+}
+
+func (o *pan2Unit) next(n int) {
+	for i := 0; i < n; i++ {
+		var (
+			pan = (math.Min(math.Max(float64(o.pos.at(i)), -1), 1) + 1) * math.Pi / 4
+			in  = float64(o.in.at(i) * o.level.at(i))
+		)
+		o.left[i] = float32(in * math.Cos(pan))
+		o.right[i] = float32(in * math.Sin(pan))
+	}
+}
+
+// outUnit mixes its channels into the output buses.
+// Control rate Outs and buses past the rendered channels are ignored.
+type outUnit struct {
+	r        *renderer
+	bus      signal
+	channels []signal
+	audio    bool
+}
+
+func newOutUnit(r *renderer, idx int, u *sc.Ugen) (unit, error) {
+	o := &outUnit{r: r, bus: r.input(u, 0), audio: u.Rate == sc.AR}
+	for i := 1; i < len(u.Inputs); i++ {
+		o.channels = append(o.channels, r.input(u, i))
+	}
+	return o, nil
+}
+
+func (o *outUnit) next(n int) {
+	if !o.audio {
+		return
+	}
+	bus := int(o.bus.at(0))
+	for ch, sig := range o.channels {
+		if bus+ch < 0 || bus+ch >= len(o.r.buses) {
+			continue
+		}
+		out := o.r.buses[bus+ch]
+		for i := 0; i < n; i++ {
+			out[i] += sig.at(i)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// watchedFile is the state of a synthdef file in a watched directory.
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+
+	// changed is when the file was last seen to change, or zero if it has been handled.
+	changed time.Time
+
+	// def and data are the last version that was sent.
+	def  *sc.Synthdef
+	data []byte
+}
+
+// watchSynth is a test synth started by the watcher.
+type watchSynth struct {
+	def       *sc.Synthdef
+	id        int32
+	releaseAt time.Time
+}
+
+// watcher re-sends the synthdefs of a directory to scsynth when their files change.
+type watcher struct {
+	dir      string
+	client   *scsynthClient
+	cat      ugenCatalog
+	debounce time.Duration
+	logger   *log.Logger
+
+	// Test synths are started with params after every send, and released after dur if it is not zero.
+	play     bool
+	params   map[string]float32
+	dur      time.Duration
+	nextNode int32
+
+	files  map[string]*watchedFile
+	synths map[string]watchSynth
+}
+
+// scan stats the synthdef files of the directory and marks new and changed files.
+// Files that have been removed are forgotten.
+func (w *watcher) scan(now time.Time) error {
+	paths, err := filepath.Glob(filepath.Join(w.dir, "*"+synthdefExt))
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue // Removed since the glob, the next scan forgets it.
+		}
+		seen[path] = true
+		f, ok := w.files[path]
+		if !ok {
+			f = &watchedFile{}
+			w.files[path] = f
+		}
+		if !ok || !fi.ModTime().Equal(f.modTime) || fi.Size() != f.size {
+			f.modTime, f.size, f.changed = fi.ModTime(), fi.Size(), now
+		}
+	}
+	for path := range w.files {
+		if !seen[path] {
+			delete(w.files, path)
+			w.logger.Printf("gone  %s", path)
+		}
+	}
+	return nil
+}
+
+// flush handles the files that have not changed for the debounce time,
+// so a build tool that writes a file several times causes a single send.
+func (w *watcher) flush(now time.Time) {
+	paths := []string{}
+	for path, f := range w.files {
+		if !f.changed.IsZero() && now.Sub(f.changed) >= w.debounce {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		f := w.files[path]
+		f.changed = time.Time{}
+		if err := w.update(path, f); err != nil {
+			w.logger.Printf("FAIL  %s: %s", path, err)
+		}
+	}
+}
+
+// update reads and checks a changed file, and sends it if it differs from the last version sent.
+// If the file cannot be read or fails the checks, the last version stays loaded.
+func (w *watcher) update(path string, f *watchedFile) error {
+	def, err := readSynthdefFile(path)
+	if err != nil {
+		return err
+	}
+	problems := append(checkGraph(def), w.cat.checkSynthdef(def)...)
+	if len(problems) > 0 {
+		return errors.Errorf("%s, not sent", strings.Join(problems, "; "))
+	}
+	data, err := synthdefBytes(def)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, f.data) {
+		w.logger.Printf("same  %s (%s), not sent", path, def.Name)
+		return nil
+	}
+	summary := "new"
+	if f.def != nil {
+		summary = diffSummary(f.def, def)
+	}
+	command, err := w.client.sendDef(def)
+	if err != nil {
+		return err
+	}
+	f.def, f.data = def, data
+	w.logger.Printf("sent  %s (%s) with %s over %s: %s", path, def.Name, command, w.client.network, summary)
+
+	if w.play {
+		return w.trigger(def)
+	}
+	return nil
+}
+
+// trigger releases the last test synth of a synthdef and starts a new one.
+func (w *watcher) trigger(def *sc.Synthdef) error {
+	if s, ok := w.synths[def.Name]; ok {
+		delete(w.synths, def.Name)
+		if err := w.client.release(s.def, s.id); err != nil {
+			return err
+		}
+	}
+	// The params are shared by every synthdef in the directory, so each one gets the params it has.
+	params := map[string]float32{}
+	for name, v := range w.params {
+		if hasParam(def, name) {
+			params[name] = v
+		}
+	}
+	id := w.nextNode
+	w.nextNode++
+	if err := w.client.synth(def.Name, id, params); err != nil {
+		return errors.Wrap(err, "test synth")
+	}
+	s := watchSynth{def: def, id: id}
+	if w.dur > 0 {
+		s.releaseAt = time.Now().Add(w.dur)
+	}
+	w.synths[def.Name] = s
+	return nil
+}
+
+// releaseDue releases the test synths whose duration is over.
+func (w *watcher) releaseDue(now time.Time) {
+	for name, s := range w.synths {
+		if s.releaseAt.IsZero() || now.Before(s.releaseAt) {
+			continue
+		}
+		delete(w.synths, name)
+		if err := w.client.release(s.def, s.id); err != nil {
+			w.logger.Printf("FAIL  releasing node %d: %s", s.id, err)
+		}
+	}
+}
+
+// checkGraph returns a description of every input that refers to a constant or ugen output
+// that does not exist, and of every param name whose index is out of range.
+// scsynth does not check these and crashes or reads garbage when they are wrong.
+func checkGraph(def *sc.Synthdef) []string {
+	problems := []string{}
+	if len(def.Ugens) == 0 {
+		problems = append(problems, "no ugens")
+	}
+	for i, u := range def.Ugens {
+		for j, in := range u.Inputs {
+			if in.IsConstant() {
+				if in.OutputIndex < 0 || int(in.OutputIndex) >= len(def.Constants) {
+					problems = append(problems, fmt.Sprintf("%s(%d) input %d refers to constant %d of %d", u.Name, i, j, in.OutputIndex, len(def.Constants)))
+				}
+				continue
+			}
+			// Ugens are sorted so that every input comes from an earlier ugen.
+			if in.UgenIndex < 0 || int(in.UgenIndex) >= i {
+				problems = append(problems, fmt.Sprintf("%s(%d) input %d refers to ugen %d, which does not come before it", u.Name, i, j, in.UgenIndex))
+				continue
+			}
+			if src := def.Ugens[in.UgenIndex]; in.OutputIndex < 0 || int(in.OutputIndex) >= len(src.Outputs) {
+				problems = append(problems, fmt.Sprintf("%s(%d) input %d refers to output %d of %s(%d), which has %d", u.Name, i, j, in.OutputIndex, src.Name, in.UgenIndex, len(src.Outputs)))
+			}
+		}
+	}
+	for _, pn := range def.ParamNames {
+		if pn.Index < 0 || int(pn.Index) >= len(def.InitialParamValues) {
+			problems = append(problems, fmt.Sprintf("param %s has index %d of %d", pn.Name, pn.Index, len(def.InitialParamValues)))
+		}
+	}
+	return problems
+}
+
+// diffSummary describes the structural differences between two versions of a synthdef in one line.
+func diffSummary(prev, next *sc.Synthdef) string {
+	parts := []string{}
+	if prev.Name != next.Name {
+		parts = append(parts, fmt.Sprintf("renamed from %s", prev.Name))
+	}
+	if added, removed := countDiff(ugenNames(prev), ugenNames(next)); len(added)+len(removed) > 0 {
+		parts = append(parts, "ugens "+signedList(added, removed))
+	}
+	if len(prev.Constants) != len(next.Constants) {
+		parts = append(parts, fmt.Sprintf("%d -> %d constants", len(prev.Constants), len(next.Constants)))
+	}
+	prevParams, nextParams := paramDefaults(prev), paramDefaults(next)
+	if added, removed := countDiff(mapKeys(prevParams), mapKeys(nextParams)); len(added)+len(removed) > 0 {
+		parts = append(parts, "params "+signedList(added, removed))
+	}
+	for _, name := range mapKeys(nextParams) {
+		if v, ok := prevParams[name]; ok && v != nextParams[name] {
+			parts = append(parts, fmt.Sprintf("%s default %g -> %g", name, v, nextParams[name]))
+		}
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, ", ")
+	}
+	// The same ugens, constants, and params, so something is wired or valued differently.
+	if diffs := prev.Diff(next); len(diffs) > 0 {
+		return fmt.Sprintf("%s -> %s", diffs[0][0], diffs[0][1])
+	}
+	return "ugens reordered"
+}
+
+// ugenNames returns the names of the ugens of a synthdef.
+func ugenNames(def *sc.Synthdef) []string {
+	names := make([]string, len(def.Ugens))
+	for i, u := range def.Ugens {
+		names[i] = u.Name
+	}
+	return names
+}
+
+// paramDefaults returns the default value of the first element of every param of a synthdef.
+func paramDefaults(def *sc.Synthdef) map[string]float32 {
+	defaults := map[string]float32{}
+	for _, slice := range paramSlices(def) {
+		if idx := int(slice.Index); idx >= 0 && idx < len(def.InitialParamValues) {
+			defaults[slice.Name] = def.InitialParamValues[idx]
+		}
+	}
+	return defaults
+}
+
+// mapKeys returns the keys of a map, sorted.
+func mapKeys(m map[string]float32) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countDiff returns the strings that b has more of than a, and the ones it has fewer of,
+// once for every extra or missing occurrence.
+func countDiff(a, b []string) (added, removed []string) {
+	counts := map[string]int{}
+	for _, s := range a {
+		counts[s]--
+	}
+	for _, s := range b {
+		counts[s]++
+	}
+	names := make([]string, 0, len(counts))
+	for s := range counts {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+	for _, s := range names {
+		for n := counts[s]; n > 0; n-- {
+			added = append(added, s)
+		}
+		for n := counts[s]; n < 0; n++ {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// signedList lists added strings with a + and removed ones with a -.
+func signedList(added, removed []string) string {
+	items := []string{}
+	for _, s := range added {
+		items = append(items, "+"+s)
+	}
+	for _, s := range removed {
+		items = append(items, "-"+s)
+	}
+	return strings.Join(items, " ")
+}
+
+// watch runs the watch command
+func (c *controller) watch() error {
+	fset := c.flagSets["watch"]
+
+	if fset.NArg() != 1 {
+		return errors.New("expected one synthdef directory")
+	}
+	if fi, err := os.Stat(fset.Arg(0)); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return errors.Errorf("%s is not a directory", fset.Arg(0))
+	}
+	if *c.watchInterval <= 0 {
+		return errors.New("-interval must be positive")
+	}
+	cat, err := c.loadCatalog()
+	if err != nil {
+		return err
+	}
+	network := "udp"
+	if *c.watchTCP {
+		network = "tcp"
+	}
+	client, err := dialScsynth(network, *c.watchAddr, *c.watchTimeout)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.close() }() // Best effort.
+
+	client.LoadDir, client.ServerDir = *c.watchLoadDir, *c.watchServerDir
+
+	w := &watcher{
+		dir:      fset.Arg(0),
+		client:   client,
+		cat:      cat,
+		debounce: *c.watchDebounce,
+		logger:   log.New(os.Stdout, "", log.LstdFlags),
+		play:     *c.watchPlay,
+		params:   map[string]float32(c.watchParams),
+		dur:      *c.watchDuration,
+		nextNode: int32(*c.watchNode),
+		files:    map[string]*watchedFile{},
+		synths:   map[string]watchSynth{},
+	}
+	w.logger.Printf("watching %s", w.dir)
+
+	for now := range time.Tick(*c.watchInterval) {
+		if err := w.scan(now); err != nil {
+			return err
+		}
+		w.flush(now)
+		w.releaseDue(now)
+	}
+	return nil
+}
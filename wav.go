@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// WAV sample formats.
+const (
+	wavFormatPCM   = 1
+	wavFormatFloat = 3
+
+	// wavFormatExtensible means the real format is in the extension of the fmt chunk.
+	wavFormatExtensible = 0xFFFE
+)
+
+// writeWAV writes a WAV file with one slice of samples per channel.
+// bits is 16 or 24 for integer PCM, or 32 for IEEE float.
+// Integer samples are clipped to the range from -1 to 1.
+func writeWAV(w io.Writer, sampleRate, bits int, channels [][]float32) error {
+	format := wavFormatPCM
+	switch bits {
+	case 16, 24:
+	case 32:
+		format = wavFormatFloat
+	default:
+		return errors.Errorf("unsupported bit depth %d, expected 16, 24, or 32", bits)
+	}
+	var (
+		frames     = 0
+		blockAlign = len(channels) * bits / 8
+		sw         = &synthdefWriter{w: w}
+	)
+	if len(channels) > 0 {
+		frames = len(channels[0])
+	}
+	dataSize := frames * blockAlign
+
+	le := func(v interface{}) {
+		if sw.err == nil {
+			sw.err = binary.Write(sw.w, binary.LittleEndian, v)
+		}
+	}
+	sw.bytes([]byte("RIFF"))
+	le(uint32(36 + dataSize))
+	sw.bytes([]byte("WAVEfmt "))
+	le(uint32(16))
+	le(uint16(format))
+	le(uint16(len(channels)))
+	le(uint32(sampleRate))
+	le(uint32(sampleRate * blockAlign))
+	le(uint16(blockAlign))
+	le(uint16(bits))
+	sw.bytes([]byte("data"))
+	le(uint32(dataSize))
+
+	sample := make([]byte, bits/8)
+	for i := 0; i < frames && sw.err == nil; i++ {
+		for _, ch := range channels {
+			v := ch[i]
+			switch bits {
+			case 16:
+				binary.LittleEndian.PutUint16(sample, uint16(int16(clipSample(v)*math.MaxInt16)))
+			case 24:
+				s := uint32(int32(clipSample(v) * (1<<23 - 1)))
+				sample[0], sample[1], sample[2] = byte(s), byte(s>>8), byte(s>>16)
+			case 32:
+				binary.LittleEndian.PutUint32(sample, math.Float32bits(v))
+			}
+			sw.bytes(sample)
+		}
+	}
+	return sw.err
+}
+
+// clipSample clips a sample to the range from -1 to 1.
+func clipSample(v float32) float32 {
+	return float32(math.Min(math.Max(float64(v), -1), 1))
+}
+
+// writeWAVFile writes a WAV file.
+func writeWAVFile(path string, sampleRate, bits int, channels [][]float32) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := writeWAV(bw, sampleRate, bits, channels); err != nil {
+		_ = f.Close() // Best effort.
+		return errors.Wrap(err, "writing "+path)
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close() // Best effort.
+		return errors.Wrap(err, "writing "+path)
+	}
+	return f.Close()
+}
+
+// readWAV reads a 16, 24, or 32-bit PCM or 32-bit float WAV file of fileSize bytes
+// and returns its sample rate and one slice of samples per channel.
+// Chunk sizes are bounded by what is left of the file, so a corrupt header cannot make it
+// allocate more than that. A data chunk that claims to be longer is read to the end of the file,
+// since streaming writers leave its size unset.
+func readWAV(r io.Reader, fileSize int64) (int, [][]float32, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, errors.Wrap(err, "reading RIFF header")
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return 0, nil, errors.New("not a WAV file")
+	}
+	var (
+		format, numChannels, bits int
+		sampleRate                int
+		haveFormat                bool
+		remaining                 = fileSize - int64(len(header))
+	)
+	for {
+		chunk := make([]byte, 8)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return 0, nil, errors.Wrap(err, "reading chunk header")
+		}
+		remaining -= int64(len(chunk))
+
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		if size > remaining {
+			if string(chunk[:4]) != "data" {
+				return 0, nil, errors.Errorf("%s chunk is %d bytes, but the file has %d left", chunk[:4], size, remaining)
+			}
+			size = remaining
+		}
+		padded := size + size%2
+		if padded > remaining {
+			padded = remaining // The pad byte of the last chunk may be missing.
+		}
+		body := make([]byte, padded)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return 0, nil, errors.Wrapf(err, "reading %s chunk", chunk[:4])
+		}
+		body = body[:size]
+		remaining -= padded
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 {
+				return 0, nil, errors.New("fmt chunk is too short")
+			}
+			format = int(binary.LittleEndian.Uint16(body))
+			numChannels = int(binary.LittleEndian.Uint16(body[2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			bits = int(binary.LittleEndian.Uint16(body[14:]))
+			if format == wavFormatExtensible && size >= 26 {
+				format = int(binary.LittleEndian.Uint16(body[24:]))
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return 0, nil, errors.New("data chunk before fmt chunk")
+			}
+			channels, err := decodeWAVData(body, format, numChannels, bits)
+			return sampleRate, channels, err
+		}
+	}
+}
+
+// decodeWAVData decodes interleaved WAV samples.
+func decodeWAVData(data []byte, format, numChannels, bits int) ([][]float32, error) {
+	switch {
+	case format == wavFormatPCM && (bits == 16 || bits == 24 || bits == 32):
+	case format == wavFormatFloat && bits == 32:
+	default:
+		return nil, errors.Errorf("unsupported WAV format %d with %d bits per sample", format, bits)
+	}
+	if numChannels <= 0 {
+		return nil, errors.New("WAV file has no channels")
+	}
+	var (
+		width    = bits / 8
+		frames   = len(data) / (width * numChannels)
+		channels = make([][]float32, numChannels)
+	)
+	for ch := range channels {
+		channels[ch] = make([]float32, frames)
+	}
+	for i := 0; i < frames; i++ {
+		for ch := range channels {
+			s := data[(i*numChannels+ch)*width:]
+			switch {
+			case format == wavFormatFloat:
+				channels[ch][i] = math.Float32frombits(binary.LittleEndian.Uint32(s))
+			case bits == 16:
+				channels[ch][i] = float32(int16(binary.LittleEndian.Uint16(s))) / math.MaxInt16
+			case bits == 24:
+				v := int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24) >> 8
+				channels[ch][i] = float32(v) / (1<<23 - 1)
+			default:
+				channels[ch][i] = float32(int32(binary.LittleEndian.Uint32(s))) / math.MaxInt32
+			}
+		}
+	}
+	return channels, nil
+}
+
+// readWAVFile reads a WAV file.
+func readWAVFile(path string) (int, [][]float32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+	sampleRate, channels, err := readWAV(bufio.NewReader(f), fi.Size())
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "reading "+path)
+	}
+	return sampleRate, channels, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/sc"
+)
+
+// synthdefVersion is the version of the synthdef files written by writeSynthdef.
+const synthdefVersion = 2
+
+// writeSynthdef writes a version 2 synthdef file containing a single synthdef.
+// It writes the same format as (*sc.Synthdef).Write, except that the param count
+// is the number of initial param values rather than the number of param names.
+// The two differ for synthdefs with arrayed params, and scsynth expects the former.
+func writeSynthdef(w io.Writer, def *sc.Synthdef) error {
+	sw := &synthdefWriter{w: w}
+
+	sw.bytes([]byte("SCgf"))
+	sw.write(int32(synthdefVersion))
+	sw.write(int16(1))
+	sw.pstring(def.Name)
+
+	sw.write(int32(len(def.Constants)))
+	sw.write(def.Constants)
+
+	sw.write(int32(len(def.InitialParamValues)))
+	sw.write(def.InitialParamValues)
+	sw.write(int32(len(def.ParamNames)))
+	for _, pn := range def.ParamNames {
+		sw.pstring(pn.Name)
+		sw.write(pn.Index)
+	}
+	sw.write(int32(len(def.Ugens)))
+	for _, u := range def.Ugens {
+		sw.pstring(u.Name)
+		sw.write(u.Rate)
+		sw.write(int32(len(u.Inputs)))
+		sw.write(int32(len(u.Outputs)))
+		sw.write(u.SpecialIndex)
+		for _, in := range u.Inputs {
+			sw.write(in.UgenIndex)
+			sw.write(in.OutputIndex)
+		}
+		for _, out := range u.Outputs {
+			sw.write(int8(out))
+		}
+	}
+	sw.write(int16(len(def.Variants)))
+	for _, v := range def.Variants {
+		sw.pstring(v.Name)
+		sw.write(v.InitialParamValues)
+	}
+	return sw.err
+}
+
+// synthdefBytes returns the bytes of a synthdef file containing a single synthdef,
+// as written by writeSynthdef.
+func synthdefBytes(def *sc.Synthdef) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeSynthdef(&buf, def); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeSynthdefFile writes a synthdef to a file.
+func writeSynthdefFile(path string, def *sc.Synthdef) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := writeSynthdef(bw, def); err != nil {
+		_ = f.Close() // Best effort.
+		return errors.Wrap(err, "writing "+path)
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close() // Best effort.
+		return errors.Wrap(err, "writing "+path)
+	}
+	return f.Close()
+}
+
+// synthdefWriter writes big-endian values and remembers the first error.
+type synthdefWriter struct {
+	w   io.Writer
+	err error
+}
+
+// write writes a fixed-size value or a slice of fixed-size values.
+func (sw *synthdefWriter) write(v interface{}) {
+	if sw.err != nil {
+		return
+	}
+	sw.err = binary.Write(sw.w, binary.BigEndian, v)
+}
+
+// bytes writes raw bytes.
+func (sw *synthdefWriter) bytes(b []byte) {
+	if sw.err != nil {
+		return
+	}
+	_, sw.err = sw.w.Write(b)
+}
+
+// pstring writes a string prefixed with its length as a single byte.
+func (sw *synthdefWriter) pstring(s string) {
+	if len(s) > 255 && sw.err == nil {
+		sw.err = errors.Errorf("string is too long: %q", s)
+	}
+	sw.write(uint8(len(s)))
+	sw.bytes([]byte(s))
+}